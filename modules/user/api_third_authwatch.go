@@ -0,0 +1,342 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+)
+
+const (
+	// ThirdAuthEventPrefix 是第三方登录结果事件的 Redis 发布/订阅频道前缀，
+	// oauthCallback 在写完 ThirdAuthcodePrefix 对应的结果后，在这个频道上广播一次，
+	// 让正在 /user/third/authwatch 等待的客户端立刻收到通知，不用再轮询。
+	ThirdAuthEventPrefix = "thirdlogin:authcode:events:"
+
+	// 登录状态枚举，和 thirdAuthStatus 轮询接口保持一致，便于老客户端复用同一套状态码
+	thirdAuthStatusWaiting = 0
+	thirdAuthStatusSuccess = 1
+	thirdAuthStatusFailed  = 2
+
+	// ThirdAuthRequesterPrefix 记录签发authcode的发起方（展示二维码的那一端）的请求指纹，
+	// thirdAuthScan 读出来给扫码端看一眼"是谁在请求登录"。
+	ThirdAuthRequesterPrefix = "thirdlogin:requester:"
+
+	// ThirdAuthScanPrefix 记录扫码这一步绑定的uid和扫码请求指纹，thirdAuthApprove会校验
+	// 当前登录uid和请求指纹都和扫码时一致，防止二维码被展示给受害者扫码、但approve是由
+	// 另一个会话/设备发起的扫码登录劫持（攻击者生成二维码，诱导受害者扫码并确认，
+	// 受害者的登录态却被灌给了攻击者一侧的authcode）。
+	ThirdAuthScanPrefix = "thirdlogin:scan:"
+
+	// thirdAuthcodeTTL 和 authcode 本身在 thirdAuthcode 里设置的过期时间保持一致
+	thirdAuthcodeTTL = 5 * time.Minute
+)
+
+var authWatchUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type thirdAuthEvent struct {
+	Status int         `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// publishThirdAuthEvent 把登录结果发布到 authcode 对应的事件频道，供 thirdAuthWatch 转发给客户端
+func (u *User) publishThirdAuthEvent(authcode string, status int, result interface{}) {
+	event := thirdAuthEvent{Status: status, Result: result}
+	data, err := json.Marshal(event)
+	if err != nil {
+		u.Error("序列化第三方登录事件失败", zap.Error(err))
+		return
+	}
+	channel := fmt.Sprintf("%s%s", ThirdAuthEventPrefix, authcode)
+	if err := u.ctx.GetRedisConn().Publish(channel, string(data)); err != nil {
+		u.Error("发布第三方登录事件失败", zap.String("authcode", authcode), zap.Error(err))
+	}
+}
+
+// thirdAuthWatch 处理 GET /user/third/authwatch?authcode=xxx，取代原来的轮询接口。
+// 优先升级为WebSocket，不支持Upgrade的客户端（比如部分小程序webview）自动降级为SSE。
+// 两种方式都是：订阅 authcode 对应的Redis频道，收到一次事件或超时后就关闭连接，
+// 不再需要 oauthCallback 里等待几秒钟让前端来得及轮询的 hack。
+func (u *User) thirdAuthWatch(c *wkhttp.Context) {
+	authcode := c.Query("authcode")
+	if len(authcode) == 0 {
+		c.ResponseError(errors.New("authcode不能为空"))
+		return
+	}
+
+	if immediate, ok := u.peekThirdAuthResult(authcode); ok {
+		u.writeAuthWatchResult(c, immediate)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		u.watchViaWebSocket(c, authcode)
+		return
+	}
+	u.watchViaSSE(c, authcode)
+}
+
+// peekThirdAuthResult 在建立长连接前先看一眼Redis里是不是已经有结果了（登录比建链还快的情况）
+func (u *User) peekThirdAuthResult(authcode string) (thirdAuthEvent, bool) {
+	result, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode))
+	if err != nil || len(result) == 0 {
+		return thirdAuthEvent{}, false
+	}
+	if result == "1" {
+		return thirdAuthEvent{}, false
+	}
+	u.ctx.GetRedisConn().Del(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode))
+	if result == "0" {
+		return thirdAuthEvent{Status: thirdAuthStatusFailed}, true
+	}
+	var loginResp *loginUserDetailResp
+	if err := util.ReadJsonByByte([]byte(result), &loginResp); err != nil {
+		return thirdAuthEvent{}, false
+	}
+	return thirdAuthEvent{Status: thirdAuthStatusSuccess, Result: loginResp}, true
+}
+
+func (u *User) writeAuthWatchResult(c *wkhttp.Context, event thirdAuthEvent) {
+	c.Response(event)
+}
+
+func (u *User) watchViaWebSocket(c *wkhttp.Context, authcode string) {
+	conn, err := authWatchUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		u.Error("升级WebSocket失败", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	event, ok := u.waitThirdAuthEvent(c.Request.Context(), authcode)
+	if !ok {
+		conn.WriteJSON(thirdAuthEvent{Status: thirdAuthStatusWaiting})
+		return
+	}
+	conn.WriteJSON(event)
+}
+
+func (u *User) watchViaSSE(c *wkhttp.Context, authcode string) {
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	event, ok := u.waitThirdAuthEvent(c.Request.Context(), authcode)
+	if !ok {
+		event = thirdAuthEvent{Status: thirdAuthStatusWaiting}
+	}
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	if flusher, ok := c.Writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// waitThirdAuthEvent 订阅 authcode 对应的事件频道，直到收到一条消息、请求被取消或超过2分钟
+func (u *User) waitThirdAuthEvent(ctx context.Context, authcode string) (thirdAuthEvent, bool) {
+	channel := fmt.Sprintf("%s%s", ThirdAuthEventPrefix, authcode)
+	sub, err := u.ctx.GetRedisConn().Subscribe(channel)
+	if err != nil {
+		u.Error("订阅第三方登录事件失败", zap.Error(err))
+		return thirdAuthEvent{}, false
+	}
+	defer sub.Close()
+
+	timeout := time.NewTimer(2 * time.Minute)
+	defer timeout.Stop()
+	select {
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			return thirdAuthEvent{}, false
+		}
+		var event thirdAuthEvent
+		if err := json.Unmarshal([]byte(msg), &event); err != nil {
+			return thirdAuthEvent{}, false
+		}
+		return event, true
+	case <-timeout.C:
+		return thirdAuthEvent{}, false
+	case <-ctx.Done():
+		return thirdAuthEvent{}, false
+	}
+}
+
+// thirdAuthRequesterInfo 是签发authcode的发起方（展示二维码的那一端）的请求指纹，
+// IP/UserAgent 明文保留供扫码端展示确认，IPHash/UAHash 用于 thirdAuthApprove 时比对扫码指纹。
+type thirdAuthRequesterInfo struct {
+	IP     string `json:"ip"`
+	UA     string `json:"ua"`
+	IPHash string `json:"ip_hash"`
+	UAHash string `json:"ua_hash"`
+}
+
+// recordThirdAuthRequester 记录签发authcode这一刻发起方的请求指纹，TTL和authcode本身对齐，
+// 过期后 thirdAuthScan 读不到就当作二维码已失效处理。
+func (u *User) recordThirdAuthRequester(authcode string, r *http.Request) error {
+	info := thirdAuthRequesterInfo{
+		IP:     util.GetClientPublicIP(r),
+		UA:     r.UserAgent(),
+		IPHash: hashFingerprint(util.GetClientPublicIP(r)),
+		UAHash: hashFingerprint(r.UserAgent()),
+	}
+	data, err := json.Marshal(&info)
+	if err != nil {
+		return errors.Wrap(err, "序列化扫码登录发起方信息失败")
+	}
+	key := fmt.Sprintf("%s%s", ThirdAuthRequesterPrefix, authcode)
+	return u.ctx.GetRedisConn().SetAndExpire(key, string(data), thirdAuthcodeTTL)
+}
+
+// thirdAuthScanInfo 是扫码时绑定的uid和请求指纹，approve时必须由同一个uid、同一个请求指纹发起，
+// 否则说明approve的调用方并不是真正完成扫码动作的那个设备/会话。
+type thirdAuthScanInfo struct {
+	UID    string `json:"uid"`
+	IPHash string `json:"ip_hash"`
+	UAHash string `json:"ua_hash"`
+}
+
+// thirdAuthScan 处理 POST /user/third/scan?authcode=xxx，由已登录的移动端在摄像头扫码后、
+// 真正调用 approve 之前调用：把扫码动作绑定到当前uid和请求指纹上，并把发起方（桌面端）的
+// IP/UA返回给客户端，用于渲染"是否确认登录 xxx 设备"的二次确认界面。没有先调用这个接口，
+// thirdAuthApprove 会直接拒绝，强制"扫码 -> 看一眼发起方信息 -> 确认"这个两步流程，
+// 避免攻击者自己生成二维码后，诱导受害者扫码一步直接完成登录（扫码登录劫持）。
+func (u *User) thirdAuthScan(c *wkhttp.Context) {
+	authcode := c.Query("authcode")
+	if len(authcode) == 0 {
+		c.ResponseError(errors.New("authcode不能为空"))
+		return
+	}
+	exists, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode))
+	if err != nil || len(exists) == 0 {
+		c.ResponseError(errors.New("二维码已失效"))
+		return
+	}
+
+	var requester thirdAuthRequesterInfo
+	requesterData, err := u.ctx.GetRedisConn().GetString(fmt.Sprintf("%s%s", ThirdAuthRequesterPrefix, authcode))
+	if err != nil || len(requesterData) == 0 {
+		c.ResponseError(errors.New("二维码已失效"))
+		return
+	}
+	if err := util.ReadJsonByByte([]byte(requesterData), &requester); err != nil {
+		u.Error("解析扫码登录发起方信息失败", zap.Error(err))
+		c.ResponseError(errors.New("二维码已失效"))
+		return
+	}
+
+	scan := thirdAuthScanInfo{
+		UID:    c.GetLoginUID(),
+		IPHash: hashFingerprint(util.GetClientPublicIP(c.Request)),
+		UAHash: hashFingerprint(c.Request.UserAgent()),
+	}
+	scanData, err := json.Marshal(&scan)
+	if err != nil {
+		c.ResponseError(errors.Wrap(err, "序列化扫码信息失败"))
+		return
+	}
+	if err := u.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", ThirdAuthScanPrefix, authcode), string(scanData), thirdAuthcodeTTL); err != nil {
+		u.Error("redis set error", zap.Error(err))
+		c.ResponseError(errors.New("redis set error"))
+		return
+	}
+
+	c.Response(gin.H{
+		"requester_ip": requester.IP,
+		"requester_ua": requester.UA,
+	})
+}
+
+// thirdQRCode 处理 GET /user/third/qrcode?authcode=xxx，把 authcode 渲染成二维码图片，
+// 供移动端扫码后调用 POST /user/third/approve 完成扫码登录，和微信PC端扫码登录的体验一致。
+func (u *User) thirdQRCode(c *wkhttp.Context) {
+	authcode := c.Query("authcode")
+	if len(authcode) == 0 {
+		c.ResponseError(errors.New("authcode不能为空"))
+		return
+	}
+	cfg := u.ctx.GetConfig()
+	content := fmt.Sprintf("%s/user/third/scan?authcode=%s", cfg.External.APIBaseURL, authcode)
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		u.Error("生成二维码失败", zap.Error(err))
+		c.ResponseError(errors.New("生成二维码失败"))
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// thirdAuthApprove 处理 POST /user/third/approve，由已登录的移动端在 thirdAuthScan 确认过
+// 发起方信息之后调用，把扫码用户的登录态回填给桌面端正在等待的 authcode，完成扫码登录。
+// 必须先调用过 thirdAuthScan，且approve的uid、请求指纹都要和扫码时一致，否则拒绝——
+// 防止攻击者自己生成二维码，诱导受害者扫码确认后，由攻击者一侧的会话直接完成登录。
+func (u *User) thirdAuthApprove(c *wkhttp.Context) {
+	var req struct {
+		Authcode string `json:"authcode"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	uid := c.GetLoginUID()
+	key := fmt.Sprintf("%s%s", ThirdAuthcodePrefix, req.Authcode)
+	exists, err := u.ctx.GetRedisConn().GetString(key)
+	if err != nil || len(exists) == 0 {
+		c.ResponseError(errors.New("二维码已失效"))
+		return
+	}
+
+	scanKey := fmt.Sprintf("%s%s", ThirdAuthScanPrefix, req.Authcode)
+	scanData, err := u.ctx.GetRedisConn().GetString(scanKey)
+	if err != nil || len(scanData) == 0 {
+		c.ResponseError(errors.New("请先扫码确认"))
+		return
+	}
+	var scan thirdAuthScanInfo
+	if err := util.ReadJsonByByte([]byte(scanData), &scan); err != nil {
+		u.Error("解析扫码信息失败", zap.Error(err))
+		c.ResponseError(errors.New("请先扫码确认"))
+		return
+	}
+	if scan.UID != uid ||
+		scan.IPHash != hashFingerprint(util.GetClientPublicIP(c.Request)) ||
+		scan.UAHash != hashFingerprint(c.Request.UserAgent()) {
+		c.ResponseError(errors.New("确认登录的设备和扫码设备不一致，请重新扫码"))
+		return
+	}
+	if err := u.ctx.GetRedisConn().Del(scanKey); err != nil {
+		u.Error("redis del error", zap.Error(err))
+	}
+
+	userInfoM, err := u.db.queryWithUID(uid)
+	if err != nil || userInfoM == nil {
+		c.ResponseError(errors.New("用户不存在"))
+		return
+	}
+	loginSpanCtx := context.Background()
+	loginResp, err := u.execLogin(userInfoM, config.APP, nil, loginSpanCtx)
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+
+	loginRespStr := util.ToJson(loginResp)
+	if err := u.ctx.GetRedisConn().SetAndExpire(key, loginRespStr, time.Minute*1); err != nil {
+		u.Error("redis set error", zap.Error(err))
+		c.ResponseError(errors.New("redis set error"))
+		return
+	}
+	u.publishThirdAuthEvent(req.Authcode, thirdAuthStatusSuccess, loginResp)
+	c.Response(gin.H{"status": "ok"})
+}
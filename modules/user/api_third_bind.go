@@ -0,0 +1,100 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// thirdBindReq 绑定第三方账号的请求体，携带的 code 和发起登录时拿到的授权码是同一套 OAuth Code
+type thirdBindReq struct {
+	Provider string `json:"provider"`
+	Code     string `json:"code"`
+}
+
+// thirdBindResp 对外展示的一条绑定记录
+type thirdBindResp struct {
+	Provider         string `json:"provider"`
+	ProviderUsername string `json:"provider_username"`
+	Avatar           string `json:"avatar"`
+	LinkedAt         int64  `json:"linked_at"`
+}
+
+// bindThird 处理 POST /user/third/bind，要求请求已登录，直接用 code 换取用户信息后建立绑定。
+// 这条路径用于客户端已经拿到一次性的 provider code（比如App内唤起的原生授权），
+// 不经过 /user/oauth/:provider/authurl + /callback 这套跳转弹窗流程。
+func (u *User) bindThird(c *wkhttp.Context) {
+	uid := c.GetLoginUID()
+	var req thirdBindReq
+	if err := c.BindJSON(&req); err != nil {
+		c.ResponseError(errors.New("请求数据格式有误！"))
+		return
+	}
+	provider, ok := u.providers().Get(req.Provider)
+	if !ok {
+		c.ResponseError(errors.Errorf("不支持的第三方登录提供方[%s]", req.Provider))
+		return
+	}
+	providerUser, err := provider.ExchangeCode(c.Request.Context(), req.Code, "", u.oauthRedirectURL(req.Provider))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	providerUser.Provider = req.Provider
+
+	existing, err := u.thirdBindDB().queryWithProviderUID(providerUser.Provider, providerUser.ProviderUID)
+	if err != nil {
+		u.Error("查询第三方账号绑定关系失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方账号绑定关系失败！"))
+		return
+	}
+	if existing != nil {
+		if existing.UID != uid {
+			c.ResponseError(errors.New("该第三方账号已被其他用户绑定"))
+			return
+		}
+		c.Response(gin.H{"status": "ok"})
+		return
+	}
+
+	if err := u.thirdBindDB().insert(providerUserToBindModel(uid, providerUser)); err != nil {
+		u.Error("绑定第三方账号失败！", zap.Error(err))
+		c.ResponseError(errors.New("绑定第三方账号失败！"))
+		return
+	}
+	c.Response(gin.H{"status": "ok"})
+}
+
+// unbindThird 处理 DELETE /user/third/bind/:provider
+func (u *User) unbindThird(c *wkhttp.Context) {
+	uid := c.GetLoginUID()
+	providerName := c.Param("provider")
+	if err := u.thirdBindDB().deleteWithUIDAndProvider(uid, providerName); err != nil {
+		u.Error("解除第三方账号绑定失败！", zap.Error(err))
+		c.ResponseError(errors.New("解除第三方账号绑定失败！"))
+		return
+	}
+	c.Response(gin.H{"status": "ok"})
+}
+
+// thirdBinds 处理 GET /user/third/binds，列出当前用户绑定的所有第三方账号
+func (u *User) thirdBinds(c *wkhttp.Context) {
+	uid := c.GetLoginUID()
+	binds, err := u.thirdBindDB().queryListWithUID(uid)
+	if err != nil {
+		u.Error("查询第三方账号绑定列表失败！", zap.Error(err))
+		c.ResponseError(errors.New("查询第三方账号绑定列表失败！"))
+		return
+	}
+	resps := make([]*thirdBindResp, 0, len(binds))
+	for _, b := range binds {
+		resps = append(resps, &thirdBindResp{
+			Provider:         b.Provider,
+			ProviderUsername: b.ProviderUsername,
+			Avatar:           b.Avatar,
+			LinkedAt:         b.LinkedAt.Unix(),
+		})
+	}
+	c.Response(resps)
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/pkg/errors"
+)
+
+// AvatarQueueKey 是待处理的头像拉取任务队列（Redis list），worker 用 BRPOPLPUSH 从这里取任务
+// 并原子地挪到 AvatarProcessingQueueKey，防止worker处理到一半崩溃导致任务丢失。
+const AvatarQueueKey = "avatar:ingest:queue"
+
+// AvatarProcessingQueueKey 存放已经被某个worker取走、正在处理中的任务，处理完毕（成功、重试耗尽或任务无法解析）后从这里移除；
+// 长时间停留在这里的任务说明对应worker异常退出了，可以由运维脚本扫描后重新入队。
+const AvatarProcessingQueueKey = "avatar:ingest:processing"
+
+// avatarBRPopLPushTimeout 是 BRPOPLPUSH 单次阻塞等待的时长，超时后worker会再次发起阻塞拉取，
+// 这样可以定期检查 ctx 是否被取消，而不是永久阻塞在一次调用里。
+const avatarBRPopLPushTimeout = 5 * time.Second
+
+// AvatarIngestJob 描述一次头像拉取任务：从 SourceURL 下载 provider 返回的头像，
+// 转码、生成多档分辨率后关联到 UID。
+type AvatarIngestJob struct {
+	UID       string `json:"uid"`
+	SourceURL string `json:"source_url"`
+	Provider  string `json:"provider"`
+}
+
+// enqueueAvatarIngestJob 把一个头像拉取任务放入队列，调用方（比如OAuth回调、账号创建流程）
+// 应该在入队后立即返回，不等待头像真正处理完成。
+func (u *User) enqueueAvatarIngestJob(job AvatarIngestJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := u.ctx.GetRedisConn().LPush(AvatarQueueKey, string(data)); err != nil {
+		return errors.Wrap(err, "头像拉取任务入队失败")
+	}
+	return nil
+}
+
+// ReingestAvatar 提供给运维脚本/命令行工具用的手动重新拉取入口，
+// 用于provider头像更新后需要重新同步、或者某个用户的头像任务此前处理失败需要补跑的场景。
+func ReingestAvatar(ctx *config.Context, uid, sourceURL, provider string) error {
+	u := &User{ctx: ctx}
+	return u.enqueueAvatarIngestJob(AvatarIngestJob{
+		UID:       uid,
+		SourceURL: sourceURL,
+		Provider:  provider,
+	})
+}
@@ -0,0 +1,100 @@
+package user
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+
+	"github.com/chai2010/webp"
+	"github.com/pkg/errors"
+	"golang.org/x/image/draw"
+)
+
+// maxAvatarSourceBytes 是下载提供方头像时允许的最大原始大小，超过这个大小直接拒绝，
+// 避免一张恶意构造的超大图片把worker的内存和带宽打满。
+const maxAvatarSourceBytes = 8 * 1024 * 1024
+
+// maxAvatarPixels 是解码前允许的最大像素数（宽*高），超过直接拒绝。只校验压缩后的字节数不够：
+// 一张几十KB的PNG/GIF可以声明上万乘上万的分辨率，解码会一次性分配几个G的像素缓冲区，
+// 把worker进程内存打爆（解压炸弹），拖累同一进程里排队的其它任务。2000万像素（约4472x4472）
+// 算是正常头像不可能达到的量级，留了足够余量。
+const maxAvatarPixels = 20_000_000
+
+// avatarResolutions 是生成的头像分辨率档位（正方形边长，像素），和客户端展示头像的几个常见尺寸对应：
+// 列表页小图、个人资料页中图、点击查看大图。
+var avatarResolutions = []int{64, 200, 640}
+
+// avatarWebPQuality 是生成webp时使用的有损压缩质量（0-100），82档只用来保证视觉效果，不追求无损
+const avatarWebPQuality = 82
+
+// readAndValidateAvatarSource 读取头像原始数据并校验大小、content-type，
+// 只接受常见的位图格式，拒绝不是图片、或者超出大小限制的内容。
+func readAndValidateAvatarSource(r io.Reader) ([]byte, error) {
+	limited := io.LimitReader(r, maxAvatarSourceBytes+1)
+	data, err := io.ReadAll(limited)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取头像原始数据失败")
+	}
+	if len(data) > maxAvatarSourceBytes {
+		return nil, errors.Errorf("头像原始数据超过大小限制[%d字节]", maxAvatarSourceBytes)
+	}
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return nil, errors.Errorf("不支持的头像格式[%s]", contentType)
+	}
+	return data, nil
+}
+
+// decodeAvatarImage 把校验过的原始数据解码成 image.Image，供后续缩放。
+// 解码前先用 image.DecodeConfig 只读文件头拿到声明的宽高做像素数校验，
+// 避免解压炸弹：不校验的话 image.Decode 会直接按声明的宽高分配像素缓冲区。
+func decodeAvatarImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "读取头像图片信息失败")
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > maxAvatarPixels {
+		return nil, errors.Errorf("头像图片尺寸超过限制[%d万像素，上限%d万像素]", pixels/10000, maxAvatarPixels/10000)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "解码头像图片失败")
+	}
+	return img, nil
+}
+
+// resizeSquare 把图片等比缩放并居中裁剪成 size x size 的正方形，用双线性插值保证清晰度
+func resizeSquare(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	scale := float64(size) / float64(srcW)
+	if s := float64(size) / float64(srcH); s > scale {
+		scale = s
+	}
+	scaledW := int(float64(srcW) * scale)
+	scaledH := int(float64(srcH) * scale)
+	scaled := image.NewRGBA(image.Rect(0, 0, scaledW, scaledH))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), src, bounds, draw.Over, nil)
+
+	offsetX := (scaledW - size) / 2
+	offsetY := (scaledH - size) / 2
+	cropped := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(cropped, cropped.Bounds(), scaled, image.Pt(offsetX, offsetY), draw.Src)
+	return cropped
+}
+
+// encodeAvatarWebP 把图片编码成webp字节，有损压缩质量由 avatarWebPQuality 决定
+func encodeAvatarWebP(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, img, &webp.Options{Lossless: false, Quality: avatarWebPQuality}); err != nil {
+		return nil, errors.Wrap(err, "编码webp头像失败")
+	}
+	return buf.Bytes(), nil
+}
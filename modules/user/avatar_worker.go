@@ -0,0 +1,129 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// avatarWorkerConcurrency 是头像拉取worker池的并发数，头像处理主要花时间在下载和转码上，
+// 适当的并发数就够用了，不需要和登录请求的QPS挂钩。
+const avatarWorkerConcurrency = 4
+
+// avatarJobMaxAttempts/avatarJobRetryBaseDelay 控制单个任务内部的失败重试（下载超时、转码失败等瞬时问题），
+// 多次用尽后任务直接丢弃并打日志，不再像老版本那样连错误都不提示。
+const avatarJobMaxAttempts = 3
+const avatarJobRetryBaseDelay = time.Second
+
+// globalAvatarWorkerPoolOnce 保证头像worker池进程内只启动一次
+var globalAvatarWorkerPoolOnce sync.Once
+
+// StartAvatarWorkerPool 启动头像拉取worker池，应该在进程启动时调用一次。
+// worker 不断从 AvatarQueueKey 阻塞拉取任务，ctx 被取消后所有worker退出。
+func (u *User) StartAvatarWorkerPool(ctx context.Context) {
+	globalAvatarWorkerPoolOnce.Do(func() {
+		for i := 0; i < avatarWorkerConcurrency; i++ {
+			go u.runAvatarWorker(ctx)
+		}
+	})
+}
+
+func (u *User) runAvatarWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		payload, err := u.ctx.GetRedisConn().BRPopLPush(AvatarQueueKey, AvatarProcessingQueueKey, avatarBRPopLPushTimeout)
+		if err != nil {
+			u.Error("读取头像拉取任务失败", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		if payload == "" {
+			continue // 超时没有新任务，继续阻塞拉取
+		}
+		u.processAvatarJobPayload(ctx, payload)
+	}
+}
+
+func (u *User) processAvatarJobPayload(ctx context.Context, payload string) {
+	var job AvatarIngestJob
+	if err := util.ReadJsonByByte([]byte(payload), &job); err != nil {
+		u.Error("解析头像拉取任务失败", zap.String("payload", payload), zap.Error(err))
+		u.ackAvatarJob(payload)
+		return
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= avatarJobMaxAttempts; attempt++ {
+		if lastErr = u.ingestAvatar(ctx, job); lastErr == nil {
+			break
+		}
+		u.Error("头像拉取任务处理失败，准备重试", zap.String("uid", job.UID), zap.Int("attempt", attempt), zap.Error(lastErr))
+		time.Sleep(avatarJobRetryBaseDelay * time.Duration(1<<uint(attempt-1)))
+	}
+	if lastErr != nil {
+		u.Error("头像拉取任务重试耗尽，放弃", zap.String("uid", job.UID), zap.String("sourceURL", job.SourceURL), zap.Error(lastErr))
+	}
+	u.ackAvatarJob(payload)
+}
+
+// ackAvatarJob 把任务从处理中列表移除，代表这条任务（不管成功还是重试耗尽）已经处理完毕
+func (u *User) ackAvatarJob(payload string) {
+	if err := u.ctx.GetRedisConn().LRem(AvatarProcessingQueueKey, payload); err != nil {
+		u.Error("移除头像处理中任务失败", zap.Error(err))
+	}
+}
+
+// ingestAvatar 下载、校验、转码 provider 头像，生成多档分辨率并上传，成功后更新 IsUploadAvatar
+func (u *User) ingestAvatar(ctx context.Context, job AvatarIngestJob) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	imgReader, err := u.fileService.DownloadImage(job.SourceURL, timeoutCtx)
+	if err != nil {
+		return errors.Wrap(err, "下载provider头像失败")
+	}
+	if imgReader == nil {
+		return errors.New("provider头像下载结果为空")
+	}
+	defer imgReader.Close()
+
+	raw, err := readAndValidateAvatarSource(imgReader)
+	if err != nil {
+		return err
+	}
+	img, err := decodeAvatarImage(raw)
+	if err != nil {
+		return err
+	}
+
+	partition := crc32.ChecksumIEEE([]byte(job.UID)) % uint32(u.ctx.GetConfig().Avatar.Partition)
+	for _, size := range avatarResolutions {
+		resized := resizeSquare(img, size)
+		encoded, err := encodeAvatarWebP(resized)
+		if err != nil {
+			return err
+		}
+		path := fmt.Sprintf("avatar/%d/%s_%d.webp", partition, job.UID, size)
+		if _, err := u.fileService.UploadFile(path, "image/webp", func(w io.Writer) error {
+			_, err := w.Write(encoded)
+			return err
+		}); err != nil {
+			return errors.Wrapf(err, "上传%d档头像失败", size)
+		}
+	}
+
+	if _, err := u.ctx.DB().Exec("update user set is_upload_avatar = 1 where uid = ?", job.UID); err != nil {
+		return errors.Wrap(err, "更新用户头像状态失败")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+)
+
+// user_third_bind 记录一个用户账号和某个第三方登录提供方身份的绑定关系，
+// 一个uid可以绑定多个provider，一个(provider, provider_uid)只能绑定一个uid。
+//
+// CREATE TABLE `user_third_bind` (
+//   `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+//   `uid` varchar(40) NOT NULL,
+//   `provider` varchar(32) NOT NULL,
+//   `provider_uid` varchar(190) NOT NULL,
+//   `provider_username` varchar(190) NOT NULL DEFAULT '',
+//   `unionid` varchar(190) NOT NULL DEFAULT '',
+//   `avatar` varchar(512) NOT NULL DEFAULT '',
+//   `raw_json` text,
+//   `linked_at` datetime NOT NULL,
+//   `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+//   `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+//   PRIMARY KEY (`id`),
+//   UNIQUE KEY `uidx_provider_provideruid` (`provider`,`provider_uid`),
+//   KEY `idx_uid` (`uid`)
+// ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+// userThirdBindModel 对应 user_third_bind 表的一行记录
+type userThirdBindModel struct {
+	Id               int64
+	UID              string
+	Provider         string
+	ProviderUID      string
+	ProviderUsername string
+	UnionID          string
+	Avatar           string
+	RawJSON          string
+	LinkedAt         time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// userThirdBindDB 是 user_third_bind 表的 DAO
+type userThirdBindDB struct {
+	ctx *config.Context
+}
+
+func newUserThirdBindDB(ctx *config.Context) *userThirdBindDB {
+	return &userThirdBindDB{ctx: ctx}
+}
+
+// insertTx 在事务内插入一条绑定记录
+func (d *userThirdBindDB) insertTx(m *userThirdBindModel, tx *sql.Tx) error {
+	_, err := tx.Exec(`insert into user_third_bind (uid,provider,provider_uid,provider_username,unionid,avatar,raw_json,linked_at) values (?,?,?,?,?,?,?,?)`,
+		m.UID, m.Provider, m.ProviderUID, m.ProviderUsername, m.UnionID, m.Avatar, m.RawJSON, time.Now())
+	return err
+}
+
+// insert 插入一条绑定记录（非事务场景，比如直接绑定已登录账号）
+func (d *userThirdBindDB) insert(m *userThirdBindModel) error {
+	_, err := d.ctx.DB().Exec(`insert into user_third_bind (uid,provider,provider_uid,provider_username,unionid,avatar,raw_json,linked_at) values (?,?,?,?,?,?,?,?)`,
+		m.UID, m.Provider, m.ProviderUID, m.ProviderUsername, m.UnionID, m.Avatar, m.RawJSON, time.Now())
+	return err
+}
+
+// queryWithProviderUID 按 (provider, provider_uid) 查找绑定记录，没有绑定时返回 nil
+func (d *userThirdBindDB) queryWithProviderUID(provider, providerUID string) (*userThirdBindModel, error) {
+	row := d.ctx.DB().QueryRow(`select id,uid,provider,provider_uid,provider_username,unionid,avatar,raw_json,linked_at,created_at,updated_at from user_third_bind where provider=? and provider_uid=?`, provider, providerUID)
+	return scanUserThirdBind(row)
+}
+
+// queryWithUIDAndProvider 查找某个用户在某个提供方下的绑定记录
+func (d *userThirdBindDB) queryWithUIDAndProvider(uid, provider string) (*userThirdBindModel, error) {
+	row := d.ctx.DB().QueryRow(`select id,uid,provider,provider_uid,provider_username,unionid,avatar,raw_json,linked_at,created_at,updated_at from user_third_bind where uid=? and provider=?`, uid, provider)
+	return scanUserThirdBind(row)
+}
+
+// queryListWithUID 列出一个用户绑定的所有第三方账号
+func (d *userThirdBindDB) queryListWithUID(uid string) ([]*userThirdBindModel, error) {
+	rows, err := d.ctx.DB().Query(`select id,uid,provider,provider_uid,provider_username,unionid,avatar,raw_json,linked_at,created_at,updated_at from user_third_bind where uid=?`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var models []*userThirdBindModel
+	for rows.Next() {
+		m := &userThirdBindModel{}
+		if err := rows.Scan(&m.Id, &m.UID, &m.Provider, &m.ProviderUID, &m.ProviderUsername, &m.UnionID, &m.Avatar, &m.RawJSON, &m.LinkedAt, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		models = append(models, m)
+	}
+	return models, rows.Err()
+}
+
+// deleteWithUIDAndProvider 解除某个用户在某个提供方下的绑定
+func (d *userThirdBindDB) deleteWithUIDAndProvider(uid, provider string) error {
+	_, err := d.ctx.DB().Exec(`delete from user_third_bind where uid=? and provider=?`, uid, provider)
+	return err
+}
+
+func scanUserThirdBind(row *sql.Row) (*userThirdBindModel, error) {
+	m := &userThirdBindModel{}
+	err := row.Scan(&m.Id, &m.UID, &m.Provider, &m.ProviderUID, &m.ProviderUsername, &m.UnionID, &m.Avatar, &m.RawJSON, &m.LinkedAt, &m.CreatedAt, &m.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,54 @@
+package user
+
+import (
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/pkg/errors"
+)
+
+// mallPlaceholderEventsURL 是 MallUser.toModel() 写入 gitee_user.events_url 的占位字符串，
+// 老版本 mallOAuth 复用了 gitee_user 表存mall账号，用这批写死的占位值（"g.XxxURL"）
+// 和真正的gitee账号区分开，真实gitee用户的 events_url 是gitee接口返回的真实地址，不会等于这个占位值。
+const mallPlaceholderEventsURL = "g.EventsURL"
+
+// MigrateGiteeRowsToThirdBind 是一个一次性迁移：把历史上混在 gitee 表里的 gitee/mall 用户
+// 迁移到 user_third_bind 表，按 events_url 是否等于 mallPlaceholderEventsURL 拆成
+// provider=gitee 和 provider=mall 两种，而不是统一标记成 gitee。
+//
+// 用法：一次性在运维脚本/命令行工具中调用，迁移完成后旧的 giteeDB 表只读保留，不再写入。
+func MigrateGiteeRowsToThirdBind(ctx *config.Context) (migrated int, err error) {
+	rows, err := ctx.DB().Query(`select uid, gitee_uid, name, avatar_url, events_url from gitee_user where gitee_uid != ''`)
+	if err != nil {
+		return 0, errors.Wrap(err, "查询gitee历史数据失败")
+	}
+	defer rows.Close()
+
+	thirdBindDB := newUserThirdBindDB(ctx)
+	for rows.Next() {
+		var uid, giteeUID, name, avatarURL, eventsURL string
+		if err := rows.Scan(&uid, &giteeUID, &name, &avatarURL, &eventsURL); err != nil {
+			return migrated, errors.Wrap(err, "扫描gitee历史数据失败")
+		}
+		provider := "gitee"
+		if eventsURL == mallPlaceholderEventsURL {
+			provider = "mall"
+		}
+		existing, err := thirdBindDB.queryWithProviderUID(provider, giteeUID)
+		if err != nil {
+			return migrated, errors.Wrap(err, "查询迁移目标是否已存在失败")
+		}
+		if existing != nil {
+			continue
+		}
+		if err := thirdBindDB.insert(&userThirdBindModel{
+			UID:              uid,
+			Provider:         provider,
+			ProviderUID:      giteeUID,
+			ProviderUsername: name,
+			Avatar:           avatarURL,
+		}); err != nil {
+			return migrated, errors.Wrap(err, "写入user_third_bind失败")
+		}
+		migrated++
+	}
+	return migrated, rows.Err()
+}
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+)
+
+// PKCEVerifierPrefix 是 code_verifier 在 Redis 中按 state 存储时使用的 key 前缀。
+// 存在 Redis 而不是进程内存里，是为了让PKCE在多实例部署下也能工作，并且可以用 GETDEL
+// 保证 code_verifier 只能被消费一次。
+const PKCEVerifierPrefix = "thirdlogin:pkce:"
+
+const pkceVerifierTTL = 10 * time.Minute
+
+// newPKCEVerifier 生成一个随机 code_verifier，并计算对应的 S256 code_challenge
+func newPKCEVerifier() (verifier, challenge string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	return verifier, challenge, nil
+}
+
+// pkceChallengeForState 为给定的 state 生成并暂存一个 code_verifier，返回对应的 code_challenge。
+// state 就是这次OAuth跳转签发给外部提供方、并会在回调时原样带回来的那个值，
+// 所以在 ExchangeCode 阶段可以用同一个 state 取回 code_verifier。
+func pkceChallengeForState(ctx *config.Context, state string) string {
+	verifier, challenge, err := newPKCEVerifier()
+	if err != nil {
+		return ""
+	}
+	key := fmt.Sprintf("%s%s", PKCEVerifierPrefix, state)
+	if err := ctx.GetRedisConn().SetAndExpire(key, verifier, pkceVerifierTTL); err != nil {
+		return ""
+	}
+	return challenge
+}
+
+// popPKCEVerifier 原子地取出并删除 state 对应的 code_verifier，找不到时返回false。
+// 没有启用PKCE的提供方（state为空或者从未调用过pkceChallengeForState）这里自然返回false。
+func popPKCEVerifier(ctx *config.Context, state string) (string, bool) {
+	if state == "" {
+		return "", false
+	}
+	key := fmt.Sprintf("%s%s", PKCEVerifierPrefix, state)
+	verifier, err := ctx.GetRedisConn().GetDel(key)
+	if err != nil || verifier == "" {
+		return "", false
+	}
+	return verifier, true
+}
@@ -0,0 +1,402 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/wkhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ProviderUser 是第三方登录提供方在授权成功后返回的标准化用户资料，
+// 所有 ThirdPartyAuthProvider 的实现都应该把各自私有的响应格式转换成这个结构。
+type ProviderUser struct {
+	Provider     string          // 提供方标识，如 gitee、github、wechat
+	ProviderUID  string          // 提供方内用户的唯一ID
+	UnionID      string          // 部分提供方（如微信）会返回的跨应用唯一ID
+	Username     string          // 登录名/昵称
+	Name         string          // 展示名称
+	Email        string          // 邮箱，部分提供方不返回
+	AvatarURL    string          // 头像地址
+	AccessToken  string          // 访问令牌
+	RefreshToken string          // 刷新令牌，部分提供方不支持
+	ExpiresIn    int64           // access_token 有效期（秒）
+	Raw          json.RawMessage // 提供方原始响应，便于排查问题及后续扩展字段
+}
+
+// ThirdPartyAuthProvider 定义了接入一个第三方登录/OIDC提供方需要实现的能力。
+// 新增一个提供方只需要实现该接口并通过 ProviderRegistry.Register 注册，不需要改动回调入口。
+type ThirdPartyAuthProvider interface {
+	// Name 返回提供方标识，必须和注册时使用的 key 以及路由中的 :provider 保持一致
+	Name() string
+	// AuthURL 生成跳转到提供方的授权地址，state 用于回调时校验，redirect 为回调地址
+	AuthURL(state, redirect string) string
+	// ExchangeCode 用授权码换取访问令牌并拉取标准化的用户信息。state 原样透传回调时收到的 state 参数，
+	// 支持PKCE的提供方用它取回签发授权地址时暂存的 code_verifier，不需要PKCE的提供方可以忽略这个参数。
+	ExchangeCode(ctx context.Context, code, state, redirect string) (*ProviderUser, error)
+	// Refresh 使用 refreshToken 换取新的访问令牌，不支持刷新的提供方返回 ErrRefreshNotSupported
+	Refresh(ctx context.Context, refreshToken string) (*ProviderUser, error)
+}
+
+// ErrRefreshNotSupported 由不支持刷新令牌的提供方在 Refresh 中返回
+var ErrRefreshNotSupported = errors.New("该提供方不支持刷新令牌")
+
+// ProviderRegistry 按名称管理已启用的 ThirdPartyAuthProvider
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]ThirdPartyAuthProvider
+}
+
+// NewProviderRegistry 创建一个空的提供方注册表
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: map[string]ThirdPartyAuthProvider{},
+	}
+}
+
+// Register 注册一个提供方，重复注册同名提供方会覆盖旧的
+func (r *ProviderRegistry) Register(p ThirdPartyAuthProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name()] = p
+}
+
+// Get 按名称查找提供方
+func (r *ProviderRegistry) Get(name string) (ThirdPartyAuthProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names 返回所有已注册的提供方名称
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// globalProviderRegistry 是进程内唯一的注册表，通过 u.providers() 懒加载并缓存，
+// 这样已有的 User handler 不需要改动构造函数签名即可拿到注册表。
+var (
+	globalProviderRegistry     *ProviderRegistry
+	globalProviderRegistryOnce sync.Once
+
+	globalThirdBindDB     *userThirdBindDB
+	globalThirdBindDBOnce sync.Once
+)
+
+// thirdBindDB 懒加载 user_third_bind 表的 DAO
+func (u *User) thirdBindDB() *userThirdBindDB {
+	globalThirdBindDBOnce.Do(func() {
+		globalThirdBindDB = newUserThirdBindDB(u.ctx)
+	})
+	return globalThirdBindDB
+}
+
+// ThirdLinkPrefix 是 authcode 关联已登录uid（账号绑定场景）的 Redis key 前缀
+const ThirdLinkPrefix = "thirdlogin:link:"
+
+// providers 返回当前配置下启用的第三方登录提供方注册表
+func (u *User) providers() *ProviderRegistry {
+	globalProviderRegistryOnce.Do(func() {
+		globalProviderRegistry = NewProviderRegistry()
+		u.registerBuiltinProviders(globalProviderRegistry, u.ctx.GetConfig())
+	})
+	return globalProviderRegistry
+}
+
+// registerBuiltinProviders 根据配置注册内置的提供方，未启用（缺少 ClientID 或 ClientSecret）的提供方不会被注册
+func (u *User) registerBuiltinProviders(registry *ProviderRegistry, cfg *config.Config) {
+	for _, pc := range loadProviderConfigs(cfg) {
+		if !pc.Enabled {
+			continue
+		}
+		provider, err := newBuiltinProvider(pc, u.ctx)
+		if err != nil {
+			u.Error("初始化第三方登录提供方失败", zap.String("provider", pc.Name), zap.Error(err))
+			continue
+		}
+		registry.Register(provider)
+	}
+}
+
+// oauthProviderAuthURL 处理 GET /user/oauth/:provider/authurl，返回跳转地址。
+// 如果请求带着已登录用户的身份（用于"绑定新的第三方账号"场景），会把 uid 和 authcode
+// 关联记录下来，回调时据此判断是走登录/注册流程还是账号绑定流程。
+func (u *User) oauthProviderAuthURL(c *wkhttp.Context) {
+	providerName := c.Param("provider")
+	provider, ok := u.providers().Get(providerName)
+	if !ok {
+		c.ResponseError(errors.Errorf("不支持的第三方登录提供方[%s]", providerName))
+		return
+	}
+	authcode := c.Query("authcode")
+	if uid := c.GetLoginUID(); uid != "" {
+		if err := u.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", ThirdLinkPrefix, authcode), uid, time.Minute*5); err != nil {
+			u.Error("记录账号绑定关联关系失败", zap.Error(err))
+			c.ResponseError(errors.New("记录账号绑定关联关系失败"))
+			return
+		}
+	}
+	redirectURL := u.oauthRedirectURL(providerName)
+	if !u.oauthRedirectAllowed(redirectURL) {
+		c.ResponseError(errors.Errorf("回调地址[%s]不在白名单内", redirectURL))
+		return
+	}
+	state, err := u.newOAuthState(authcode, providerName, c.Request)
+	if err != nil {
+		u.Error("签发oauth state失败", zap.Error(err))
+		c.ResponseError(errors.New("签发oauth state失败"))
+		return
+	}
+	c.Response(gin.H{
+		"authurl": provider.AuthURL(state, redirectURL),
+	})
+}
+
+// oauthRedirectURL 生成提供方回调地址：配置了 ProviderConfig.RedirectURL 时用配置的地址，
+// 否则用所有提供方共用的路由 /user/oauth/:provider/callback
+func (u *User) oauthRedirectURL(providerName string) string {
+	cfg := u.ctx.GetConfig()
+	for _, pc := range loadProviderConfigs(cfg) {
+		if pc.Name == providerName && pc.RedirectURL != "" {
+			return pc.RedirectURL
+		}
+	}
+	return fmt.Sprintf("%s/user/oauth/%s/callback", cfg.External.APIBaseURL, providerName)
+}
+
+// oauthCallback 是所有第三方登录提供方共用的回调入口：
+// 统一完成 code 换取用户信息、账号查找/创建、头像拉取任务入队、以及把登录结果写回 authcode 对应的 Redis key。
+// POST /user/oauth/:provider/callback
+func (u *User) oauthCallback(c *wkhttp.Context) {
+	providerName := c.Param("provider")
+	provider, ok := u.providers().Get(providerName)
+	if !ok {
+		c.ResponseError(errors.Errorf("不支持的第三方登录提供方[%s]", providerName))
+		return
+	}
+	code := c.Query("code")
+	if len(code) == 0 {
+		c.ResponseError(errors.New("code不能为空"))
+		return
+	}
+	state := c.Query("state")
+	authcode, err := u.verifyAndConsumeOAuthState(state, providerName, c.Request)
+	if err != nil {
+		u.Error("oauth state校验失败", zap.Error(err), zap.String("provider", providerName))
+		c.ResponseError(errors.New("登录请求已失效，请重新扫码/授权"))
+		return
+	}
+
+	providerUser, err := provider.ExchangeCode(c.Request.Context(), code, state, u.oauthRedirectURL(providerName))
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+	if providerUser == nil {
+		c.ResponseError(errors.New("获取第三方用户信息失败"))
+		return
+	}
+	providerUser.Provider = providerName
+
+	var loginResp *loginUserDetailResp
+	linkUID, _ := u.popLinkUID(authcode)
+	if linkUID != "" {
+		loginResp, err = u.linkProviderToUID(c, linkUID, providerUser)
+	} else {
+		loginResp, err = u.loginOrCreateWithProviderUser(c, providerUser)
+	}
+	if err != nil {
+		c.ResponseError(err)
+		return
+	}
+
+	var loginRespStr string
+	if loginResp != nil {
+		loginRespStr = util.ToJson(loginResp)
+	} else {
+		loginRespStr = "0"
+	}
+	err = u.ctx.GetRedisConn().SetAndExpire(fmt.Sprintf("%s%s", ThirdAuthcodePrefix, authcode), loginRespStr, time.Minute*1)
+	if err != nil {
+		u.Error("redis set error", zap.Error(err))
+		c.ResponseError(errors.New("redis set error"))
+		return
+	}
+	status := thirdAuthStatusSuccess
+	if loginResp == nil {
+		status = thirdAuthStatusFailed
+	}
+	u.publishThirdAuthEvent(authcode, status, loginResp)
+	c.Response(gin.H{
+		"status": "ok",
+	})
+}
+
+// loginOrCreateWithProviderUser 根据 (provider, provider_uid) 在 user_third_bind 表里查找绑定关系，
+// 找到就登录已绑定的账号，找不到就创建一个新账号并建立绑定。
+func (u *User) loginOrCreateWithProviderUser(c *wkhttp.Context, pu *ProviderUser) (*loginUserDetailResp, error) {
+	bind, err := u.thirdBindDB().queryWithProviderUID(pu.Provider, pu.ProviderUID)
+	if err != nil {
+		u.Error("查询第三方账号绑定关系失败！", zap.String("provider", pu.Provider), zap.String("providerUID", pu.ProviderUID))
+		return nil, errors.New("查询第三方账号绑定关系失败！")
+	}
+
+	loginSpan := u.ctx.Tracer().StartSpan(
+		fmt.Sprintf("%slogin", pu.Provider),
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer loginSpan.Finish()
+	deviceFlag := config.APP
+	loginSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), loginSpan)
+	loginSpan.SetTag("username", pu.Username)
+
+	if bind != nil {
+		userInfoM, err := u.db.queryWithUID(bind.UID)
+		if err != nil {
+			u.Error("查询用户信息失败！", zap.String("uid", bind.UID))
+			return nil, errors.New("查询用户信息失败！")
+		}
+		if userInfoM == nil || userInfoM.IsDestroy == 1 {
+			return nil, errors.New("用户不存在")
+		}
+		loginResp, err := u.execLogin(userInfoM, deviceFlag, nil, loginSpanCtx)
+		if err != nil {
+			return nil, err
+		}
+		publicIP := util.GetClientPublicIP(c.Request)
+		go u.sentWelcomeMsg(publicIP, userInfoM.UID)
+		return loginResp, nil
+	}
+
+	uid := util.GenerUUID()
+	name := pu.Name
+	if strings.TrimSpace(name) == "" {
+		name = pu.Username
+	}
+	model := &createUserModel{
+		UID:      uid,
+		Zone:     "",
+		Phone:    "",
+		Password: "",
+		Name:     name,
+		Flag:     int(deviceFlag.Uint8()),
+	}
+	tx, err := u.ctx.DB().Begin()
+	if err != nil {
+		u.Error("开启事务失败！", zap.Error(err))
+		return nil, errors.New("开启事务失败！")
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	err = u.thirdBindDB().insertTx(providerUserToBindModel(uid, pu), tx)
+	if err != nil {
+		tx.Rollback()
+		u.Error("插入第三方账号绑定关系失败！", zap.Error(err))
+		return nil, errors.New("插入第三方账号绑定关系失败！")
+	}
+
+	publicIP := util.GetClientPublicIP(c.Request)
+	loginResp, err := u.createUserWithRespAndTx(loginSpanCtx, model, publicIP, "", tx, func() error {
+		err := tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			u.Error("数据库事物提交失败", zap.Error(err))
+			return errors.New("数据库事物提交失败")
+		}
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if pu.AvatarURL != "" && !strings.HasSuffix(pu.AvatarURL, "no_portrait.png") {
+		if err := u.enqueueAvatarIngestJob(AvatarIngestJob{UID: uid, SourceURL: pu.AvatarURL, Provider: pu.Provider}); err != nil {
+			u.Error("头像拉取任务入队失败", zap.Error(err))
+		}
+	}
+	return loginResp, nil
+}
+
+// linkProviderToUID 把第三方身份绑定到一个已登录的账号上，而不是登录/创建新账号，
+// 绑定成功后返回该账号当前的登录态，这样弹窗流程拿到的响应结构和登录流程保持一致。
+func (u *User) linkProviderToUID(c *wkhttp.Context, uid string, pu *ProviderUser) (*loginUserDetailResp, error) {
+	existing, err := u.thirdBindDB().queryWithProviderUID(pu.Provider, pu.ProviderUID)
+	if err != nil {
+		return nil, errors.New("查询第三方账号绑定关系失败！")
+	}
+	if existing != nil && existing.UID != uid {
+		return nil, errors.New("该第三方账号已被其他用户绑定")
+	}
+	if existing == nil {
+		if err := u.thirdBindDB().insert(providerUserToBindModel(uid, pu)); err != nil {
+			u.Error("绑定第三方账号失败！", zap.Error(err))
+			return nil, errors.New("绑定第三方账号失败！")
+		}
+	}
+
+	userInfoM, err := u.db.queryWithUID(uid)
+	if err != nil || userInfoM == nil {
+		return nil, errors.New("用户不存在")
+	}
+	loginSpan := u.ctx.Tracer().StartSpan(
+		fmt.Sprintf("%sbind", pu.Provider),
+		opentracing.ChildOf(c.GetSpanContext()),
+	)
+	defer loginSpan.Finish()
+	loginSpanCtx := u.ctx.Tracer().ContextWithSpan(context.Background(), loginSpan)
+	return u.execLogin(userInfoM, config.APP, nil, loginSpanCtx)
+}
+
+// popLinkUID 取出并删除 authcode 关联的已登录uid，仅在 oauthProviderAuthURL 阶段是
+// 带着登录态发起（即"绑定新账号"）时才存在
+func (u *User) popLinkUID(authcode string) (string, error) {
+	key := fmt.Sprintf("%s%s", ThirdLinkPrefix, authcode)
+	uid, err := u.ctx.GetRedisConn().GetString(key)
+	if err != nil {
+		return "", err
+	}
+	if uid != "" {
+		if err := u.ctx.GetRedisConn().Del(key); err != nil {
+			u.Error("删除账号绑定关联关系失败", zap.Error(err))
+		}
+	}
+	return uid, nil
+}
+
+// providerUserToBindModel 把标准化的 ProviderUser 转换成 user_third_bind 的写入模型
+func providerUserToBindModel(uid string, pu *ProviderUser) *userThirdBindModel {
+	rawJSON := ""
+	if len(pu.Raw) > 0 {
+		rawJSON = string(pu.Raw)
+	}
+	return &userThirdBindModel{
+		UID:              uid,
+		Provider:         pu.Provider,
+		ProviderUID:      pu.ProviderUID,
+		ProviderUsername: pu.Username,
+		UnionID:          pu.UnionID,
+		Avatar:           pu.AvatarURL,
+		RawJSON:          rawJSON,
+	}
+}
@@ -0,0 +1,214 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/network"
+	"github.com/pkg/errors"
+)
+
+// newBuiltinProvider 根据 ProviderConfig.Name 构造对应的内置 ThirdPartyAuthProvider 实现，
+// ctx 只有支持PKCE的OIDC类提供方需要，用来把 code_verifier 暂存到Redis
+func newBuiltinProvider(pc ProviderConfig, ctx *config.Context) (ThirdPartyAuthProvider, error) {
+	switch pc.Name {
+	case "gitee":
+		return newGiteeProvider(pc), nil
+	case "github":
+		return newGithubProvider(pc), nil
+	case "google":
+		return newGoogleProvider(pc, ctx), nil
+	case "wechat":
+		return newWechatProvider(pc), nil
+	case "apple":
+		return newAppleProvider(pc, ctx), nil
+	case "oidc":
+		return newOIDCProvider(pc, ctx)
+	}
+	return nil, errors.Errorf("未知的内置提供方[%s]", pc.Name)
+}
+
+// ---------- gitee ----------
+
+type giteeProvider struct {
+	cfg ProviderConfig
+}
+
+func newGiteeProvider(cfg ProviderConfig) *giteeProvider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = "https://gitee.com/oauth/authorize"
+	}
+	return &giteeProvider{cfg: cfg}
+}
+
+func (p *giteeProvider) Name() string { return "gitee" }
+
+func (p *giteeProvider) AuthURL(state, redirect string) string {
+	return fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&state=%s", p.cfg.AuthURL, p.cfg.ClientID, url.QueryEscape(redirect), state)
+}
+
+func (p *giteeProvider) ExchangeCode(ctx context.Context, code, state, redirect string) (*ProviderUser, error) {
+	result, err := network.PostForWWWForm("https://gitee.com/oauth/token?grant_type=authorization_code", map[string]string{
+		"code":          code,
+		"client_id":     p.cfg.ClientID,
+		"redirect_uri":  redirect,
+		"client_secret": p.cfg.ClientSecret,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, _ := result["access_token"].(string)
+	if accessToken == "" {
+		return nil, errors.New("获取gitee access_token失败")
+	}
+	resp, err := network.Get(fmt.Sprintf("https://gitee.com/api/v5/user?access_token=%s", accessToken), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("获取gitee用户信息失败，状态码：%d", resp.StatusCode)
+	}
+	var info giteeUserInfo
+	if err := json.Unmarshal([]byte(resp.Body), &info); err != nil {
+		return nil, err
+	}
+	return &ProviderUser{
+		ProviderUID: info.Login,
+		Username:    info.Login,
+		Name:        firstNonEmpty(info.Name, info.Login),
+		Email:       info.Email,
+		AvatarURL:   info.AvatarURL,
+		AccessToken: accessToken,
+		Raw:         json.RawMessage(resp.Body),
+	}, nil
+}
+
+func (p *giteeProvider) Refresh(ctx context.Context, refreshToken string) (*ProviderUser, error) {
+	return nil, ErrRefreshNotSupported
+}
+
+// ---------- github ----------
+
+type githubProvider struct {
+	cfg ProviderConfig
+}
+
+func newGithubProvider(cfg ProviderConfig) *githubProvider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = "https://github.com/login/oauth/authorize"
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = "https://github.com/login/oauth/access_token"
+	}
+	if cfg.UserInfoURL == "" {
+		cfg.UserInfoURL = "https://api.github.com/user"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	return &githubProvider{cfg: cfg}
+}
+
+func (p *githubProvider) Name() string { return "github" }
+
+func (p *githubProvider) AuthURL(state, redirect string) string {
+	return fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&scope=%s&state=%s",
+		p.cfg.AuthURL, p.cfg.ClientID, url.QueryEscape(redirect), url.QueryEscape(strings.Join(p.cfg.Scopes, " ")), state)
+}
+
+func (p *githubProvider) ExchangeCode(ctx context.Context, code, state, redirect string) (*ProviderUser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("client_secret", p.cfg.ClientSecret)
+	q.Set("code", code)
+	q.Set("redirect_uri", redirect)
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		ErrorDesc   string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.Errorf("获取github access_token失败：%s %s", tokenResp.Error, tokenResp.ErrorDesc)
+	}
+
+	userReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	userReq.Header.Set("Authorization", "Bearer "+tokenResp.AccessToken)
+	userReq.Header.Set("Accept", "application/vnd.github+json")
+	userResp, err := http.DefaultClient.Do(userReq)
+	if err != nil {
+		return nil, err
+	}
+	defer userResp.Body.Close()
+	if userResp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("获取github用户信息失败，状态码：%d", userResp.StatusCode)
+	}
+	var info struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	rawBody, err := jsonDecodeAndKeepRaw(userResp.Body, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderUser{
+		ProviderUID: fmt.Sprintf("%d", info.ID),
+		Username:    info.Login,
+		Name:        firstNonEmpty(info.Name, info.Login),
+		Email:       info.Email,
+		AvatarURL:   info.AvatarURL,
+		AccessToken: tokenResp.AccessToken,
+		Raw:         rawBody,
+	}, nil
+}
+
+func (p *githubProvider) Refresh(ctx context.Context, refreshToken string) (*ProviderUser, error) {
+	return nil, ErrRefreshNotSupported
+}
+
+// jsonDecodeAndKeepRaw 解析 JSON 响应体到 v，同时返回读取到的原始字节，方便把 Raw 字段塞进 ProviderUser
+func jsonDecodeAndKeepRaw(r io.Reader, v interface{}) (json.RawMessage, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(body), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"os"
+	"strings"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+)
+
+// ProviderConfig 描述一个第三方登录提供方的可运行时配置项，运营方无需改动 Go 代码，
+// 只需要配置对应的环境变量即可启用/停用某个提供方，或者切换到自建的 OIDC 地址。
+type ProviderConfig struct {
+	Name         string   // 提供方标识，如 gitee、github、wechat、apple、google、oidc
+	Enabled      bool     // 是否启用，ClientID或ClientSecret为空时视为未启用
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // 为空时使用 /user/oauth/:provider/callback
+	Scopes       []string
+	AuthURL      string   // 授权地址，内置提供方有默认值，可覆盖
+	TokenURL     string   // 换取access_token的地址，内置提供方有默认值，可覆盖
+	UserInfoURL  string   // 获取用户信息的地址，内置提供方有默认值，可覆盖
+	DiscoveryURL string   // OIDC专用：.well-known/openid-configuration 地址
+}
+
+// loadProviderConfigs 从环境变量加载内置提供方的配置。约定前缀 OAUTH_<PROVIDER>_，
+// 例如 OAUTH_GITHUB_CLIENT_ID / OAUTH_GITHUB_CLIENT_SECRET / OAUTH_GITHUB_SCOPES。
+// gitee 额外兼容已有的 cfg.Gitee.* 配置，保证升级后无需重新配置。
+func loadProviderConfigs(cfg *config.Config) []ProviderConfig {
+	configs := make([]ProviderConfig, 0, 6)
+	for _, name := range []string{"gitee", "github", "wechat", "apple", "google", "oidc"} {
+		pc := ProviderConfig{
+			Name:         name,
+			ClientID:     envWithDefault("OAUTH_"+strings.ToUpper(name)+"_CLIENT_ID", ""),
+			ClientSecret: envWithDefault("OAUTH_"+strings.ToUpper(name)+"_CLIENT_SECRET", ""),
+			RedirectURL:  envWithDefault("OAUTH_"+strings.ToUpper(name)+"_REDIRECT_URL", ""),
+			AuthURL:      envWithDefault("OAUTH_"+strings.ToUpper(name)+"_AUTH_URL", ""),
+			TokenURL:     envWithDefault("OAUTH_"+strings.ToUpper(name)+"_TOKEN_URL", ""),
+			UserInfoURL:  envWithDefault("OAUTH_"+strings.ToUpper(name)+"_USERINFO_URL", ""),
+			DiscoveryURL: envWithDefault("OAUTH_"+strings.ToUpper(name)+"_DISCOVERY_URL", ""),
+		}
+		if scopes := envWithDefault("OAUTH_"+strings.ToUpper(name)+"_SCOPES", ""); scopes != "" {
+			pc.Scopes = strings.Split(scopes, ",")
+		}
+		if name == "gitee" {
+			if pc.ClientID == "" {
+				pc.ClientID = cfg.Gitee.ClientID
+			}
+			if pc.ClientSecret == "" {
+				pc.ClientSecret = cfg.Gitee.ClientSecret
+			}
+			if pc.AuthURL == "" {
+				pc.AuthURL = cfg.Gitee.OAuthURL
+			}
+		}
+		pc.Enabled = pc.ClientID != "" && pc.ClientSecret != ""
+		configs = append(configs, pc)
+	}
+	return configs
+}
+
+func envWithDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,303 @@
+package user
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// oidcDiscovery 是 .well-known/openid-configuration 响应中我们关心的字段
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	Issuer                string `json:"issuer"`
+}
+
+// oidcProvider 实现了通用的 OIDC Authorization Code + PKCE 流程，ID Token 使用 JWKS 做签名校验。
+// google 和 apple 都是标准 OIDC Provider，复用同一套实现，只是 discovery 地址不同，默认 scope 都是 openid/profile/email。
+type oidcProvider struct {
+	name string
+	cfg  ProviderConfig
+	ctx  *config.Context
+	disc oidcDiscovery
+	jwks *jwksCache
+}
+
+func newOIDCProvider(cfg ProviderConfig, ctx *config.Context) (*oidcProvider, error) {
+	if cfg.DiscoveryURL == "" {
+		return nil, errors.Errorf("oidc提供方[%s]缺少DiscoveryURL配置", cfg.Name)
+	}
+	disc, err := fetchOIDCDiscovery(cfg.DiscoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &oidcProvider{
+		name: cfg.Name,
+		cfg:  cfg,
+		ctx:  ctx,
+		disc: disc,
+		jwks: newJWKSCache(disc.JWKSURI),
+	}, nil
+}
+
+func newGoogleProvider(cfg ProviderConfig, ctx *config.Context) *oidcProvider {
+	if cfg.DiscoveryURL == "" {
+		cfg.DiscoveryURL = "https://accounts.google.com/.well-known/openid-configuration"
+	}
+	p, err := newOIDCProvider(cfg, ctx)
+	if err != nil {
+		// google的discovery地址是固定的公网地址，正常情况下不会失败；保留一个不可用的占位 provider
+		// 而不是让整个注册流程 panic，失败会在 ExchangeCode 时明确报错。
+		return &oidcProvider{name: "google", cfg: cfg, ctx: ctx}
+	}
+	p.name = "google"
+	return p
+}
+
+func newAppleProvider(cfg ProviderConfig, ctx *config.Context) *oidcProvider {
+	if cfg.DiscoveryURL == "" {
+		cfg.DiscoveryURL = "https://appleid.apple.com/.well-known/openid-configuration"
+	}
+	p, err := newOIDCProvider(cfg, ctx)
+	if err != nil {
+		return &oidcProvider{name: "apple", cfg: cfg, ctx: ctx}
+	}
+	p.name = "apple"
+	return p
+}
+
+func (p *oidcProvider) Name() string { return p.name }
+
+// AuthURL 生成带 PKCE code_challenge 的授权地址，code_verifier 按 state 暂存到Redis，
+// ExchangeCode 阶段会用回调时收到的同一个 state 取回来
+func (p *oidcProvider) AuthURL(state, redirect string) string {
+	challenge := pkceChallengeForState(p.ctx, state)
+	return fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&scope=%s&state=%s&code_challenge=%s&code_challenge_method=S256",
+		p.disc.AuthorizationEndpoint, p.cfg.ClientID, url.QueryEscape(redirect), url.QueryEscape(strings.Join(p.cfg.Scopes, " ")), state, challenge)
+}
+
+func (p *oidcProvider) ExchangeCode(ctx context.Context, code, state, redirect string) (*ProviderUser, error) {
+	if p.disc.TokenEndpoint == "" {
+		return nil, errors.Errorf("oidc提供方[%s]未正确初始化", p.name)
+	}
+	verifier, _ := popPKCEVerifier(p.ctx, state)
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	form.Set("redirect_uri", redirect)
+	if verifier != "" {
+		form.Set("code_verifier", verifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.Errorf("oidc提供方[%s]未返回id_token", p.name)
+	}
+	claims, err := p.verifyIDToken(tokenResp.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	picture, _ := claims["picture"].(string)
+	return &ProviderUser{
+		ProviderUID:  sub,
+		Username:     firstNonEmpty(name, email, sub),
+		Name:         firstNonEmpty(name, email),
+		Email:        email,
+		AvatarURL:    picture,
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+	}, nil
+}
+
+func (p *oidcProvider) Refresh(ctx context.Context, refreshToken string) (*ProviderUser, error) {
+	if p.disc.TokenEndpoint == "" {
+		return nil, ErrRefreshNotSupported
+	}
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	return &ProviderUser{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+	}, nil
+}
+
+// verifyIDToken 校验 id_token 的签名（RS256，通过 jwks_uri 拿公钥）和有效期，返回其 claims
+func (p *oidcProvider) verifyIDToken(idToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.jwks.publicKey(kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "id_token签名校验失败")
+	}
+	if p.disc.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != p.disc.Issuer {
+			return nil, errors.Errorf("id_token issuer不匹配：%s", iss)
+		}
+	}
+	if !audContainsClientID(claims["aud"], p.cfg.ClientID) {
+		return nil, errors.Errorf("id_token audience不匹配，可能是签发给其他应用的id_token[provider=%s]", p.name)
+	}
+	return claims, nil
+}
+
+// audContainsClientID 校验id_token的aud claim是否包含本应用的client_id，
+// aud按JWT规范可能是单个字符串也可能是字符串数组，两种形式都要支持。
+func audContainsClientID(aud interface{}, clientID string) bool {
+	if clientID == "" {
+		return false
+	}
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func fetchOIDCDiscovery(discoveryURL string) (oidcDiscovery, error) {
+	resp, err := http.Get(discoveryURL)
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return oidcDiscovery{}, errors.Errorf("获取oidc discovery文档失败，状态码：%d", resp.StatusCode)
+	}
+	var disc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&disc); err != nil {
+		return oidcDiscovery{}, err
+	}
+	return disc, nil
+}
+
+// jwksCache 缓存从 jwks_uri 拉取的公钥，按 kid 查找，定期过期重新拉取
+type jwksCache struct {
+	mu        sync.Mutex
+	jwksURI   string
+	fetchedAt time.Time
+	keys      map[string]*rsa.PublicKey
+}
+
+func newJWKSCache(jwksURI string) *jwksCache {
+	return &jwksCache{jwksURI: jwksURI, keys: map[string]*rsa.PublicKey{}}
+}
+
+func (j *jwksCache) publicKey(kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if time.Since(j.fetchedAt) > time.Hour || len(j.keys) == 0 {
+		if err := j.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("jwks中找不到kid[%s]对应的公钥", kid)
+	}
+	return key, nil
+}
+
+func (j *jwksCache) refresh() error {
+	resp, err := http.Get(j.jwksURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range body.Keys {
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		e := 0
+		for _, b := range eBytes {
+			e = e<<8 | int(b)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: e}
+	}
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// wechatProvider 实现微信网页/移动应用扫码登录（OAuth2.0），与标准OIDC提供方不同，
+// 微信没有id_token，用户信息需要额外用access_token+openid换取。
+type wechatProvider struct {
+	cfg ProviderConfig
+}
+
+func newWechatProvider(cfg ProviderConfig) *wechatProvider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = "https://open.weixin.qq.com/connect/qrconnect"
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = "https://api.weixin.qq.com/sns/oauth2/access_token"
+	}
+	if cfg.UserInfoURL == "" {
+		cfg.UserInfoURL = "https://api.weixin.qq.com/sns/userinfo"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"snsapi_login"}
+	}
+	return &wechatProvider{cfg: cfg}
+}
+
+func (p *wechatProvider) Name() string { return "wechat" }
+
+func (p *wechatProvider) AuthURL(state, redirect string) string {
+	return fmt.Sprintf("%s?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect",
+		p.cfg.AuthURL, p.cfg.ClientID, url.QueryEscape(redirect), state)
+}
+
+func (p *wechatProvider) ExchangeCode(ctx context.Context, code, state, redirect string) (*ProviderUser, error) {
+	tokenURL := fmt.Sprintf("%s?appid=%s&secret=%s&code=%s&grant_type=authorization_code", p.cfg.TokenURL, p.cfg.ClientID, p.cfg.ClientSecret, code)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		OpenID       string `json:"openid"`
+		UnionID      string `json:"unionid"`
+		ErrCode      int    `json:"errcode"`
+		ErrMsg       string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.Errorf("获取微信access_token失败：%d %s", tokenResp.ErrCode, tokenResp.ErrMsg)
+	}
+
+	userInfoURL := fmt.Sprintf("%s?access_token=%s&openid=%s", p.cfg.UserInfoURL, tokenResp.AccessToken, tokenResp.OpenID)
+	userReq, err := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	userResp, err := http.DefaultClient.Do(userReq)
+	if err != nil {
+		return nil, err
+	}
+	defer userResp.Body.Close()
+	var info struct {
+		OpenID     string `json:"openid"`
+		Nickname   string `json:"nickname"`
+		HeadImgURL string `json:"headimgurl"`
+		UnionID    string `json:"unionid"`
+		ErrCode    int    `json:"errcode"`
+		ErrMsg     string `json:"errmsg"`
+	}
+	body, err := jsonDecodeAndKeepRaw(userResp.Body, &info)
+	if err != nil {
+		return nil, err
+	}
+	if info.ErrCode != 0 {
+		return nil, errors.Errorf("获取微信用户信息失败：%d %s", info.ErrCode, info.ErrMsg)
+	}
+	return &ProviderUser{
+		ProviderUID: firstNonEmpty(info.OpenID, tokenResp.OpenID),
+		UnionID:     firstNonEmpty(info.UnionID, tokenResp.UnionID),
+		Username:    info.Nickname,
+		Name:        info.Nickname,
+		AvatarURL:   info.HeadImgURL,
+		AccessToken: tokenResp.AccessToken,
+		ExpiresIn:   tokenResp.ExpiresIn,
+		Raw:         body,
+	}, nil
+}
+
+func (p *wechatProvider) Refresh(ctx context.Context, refreshToken string) (*ProviderUser, error) {
+	refreshURL := fmt.Sprintf("https://api.weixin.qq.com/sns/oauth2/refresh_token?appid=%s&grant_type=refresh_token&refresh_token=%s", p.cfg.ClientID, refreshToken)
+	resp, err := http.Get(refreshURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		OpenID       string `json:"openid"`
+		ErrCode      int    `json:"errcode"`
+		ErrMsg       string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.Errorf("刷新微信access_token失败：%d %s", tokenResp.ErrCode, tokenResp.ErrMsg)
+	}
+	return &ProviderUser{
+		ProviderUID:  tokenResp.OpenID,
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+	}, nil
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/util"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// oauthStateTTL 是签发的 state 的有效期，超过这个时间的回调一律视为过期拒绝
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthStateNoncePrefix 是 state 里 nonce 在 Redis 中的 key 前缀，用来保证 state 只能被消费一次，
+// 防止同一个回调地址被重放。
+const OAuthStateNoncePrefix = "thirdlogin:state:"
+
+// oauthStateClaims 是签发给第三方提供方、再由其回调时原样带回来的 state 的载荷。
+// authcode 是真正要关联登录结果的业务标识，nonce/ip_hash/ua_hash 都只是用来在回调时
+// 校验"这确实是我们刚刚签发、且还没被用过的那个 state"，不参与业务逻辑。
+type oauthStateClaims struct {
+	Authcode string `json:"authcode"`
+	Nonce    string `json:"nonce"`
+	IPHash   string `json:"ip_hash"`
+	UAHash   string `json:"ua_hash"`
+	Provider string `json:"provider"`
+	jwt.RegisteredClaims
+}
+
+// oauthStateSecret 返回用于签名 state 的密钥，必须通过环境变量配置。
+// state 是整个CSRF/重放防护的信任根，不给占位默认值——没配置就拒绝签发/校验，
+// 而不是悄悄用一个任何人都能在这个开源仓库里读到的默认密钥签名。
+func oauthStateSecret() ([]byte, error) {
+	secret := strings.TrimSpace(os.Getenv("OAUTH_STATE_SECRET"))
+	if secret == "" {
+		return nil, errors.New("未配置OAUTH_STATE_SECRET，拒绝签发/校验oauth state")
+	}
+	return []byte(secret), nil
+}
+
+// newOAuthState 签发一个绑定了 authcode、提供方和当前请求指纹的 state，
+// nonce 会额外存一份到 Redis，回调时用 GETDEL 原子消费，保证同一个 state 只能成功一次。
+func (u *User) newOAuthState(authcode, provider string, r *http.Request) (string, error) {
+	nonce := util.GenerUUID()
+	nonceKey := fmt.Sprintf("%s%s", OAuthStateNoncePrefix, nonce)
+	if err := u.ctx.GetRedisConn().SetAndExpire(nonceKey, "1", oauthStateTTL); err != nil {
+		return "", errors.Wrap(err, "记录oauth state nonce失败")
+	}
+
+	now := time.Now()
+	claims := oauthStateClaims{
+		Authcode: authcode,
+		Nonce:    nonce,
+		IPHash:   hashFingerprint(util.GetClientPublicIP(r)),
+		UAHash:   hashFingerprint(r.UserAgent()),
+		Provider: provider,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oauthStateTTL)),
+		},
+	}
+	secret, err := oauthStateSecret()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret)
+}
+
+// verifyAndConsumeOAuthState 校验回调带回来的 state：签名、有效期、提供方是否匹配、
+// 请求指纹（IP+UA）是否和签发时一致，并且原子地消费掉对应的 nonce（只能成功一次）。
+// 校验通过后返回签发时绑定的 authcode。
+func (u *User) verifyAndConsumeOAuthState(stateToken, provider string, r *http.Request) (string, error) {
+	if stateToken == "" {
+		return "", errors.New("state不能为空")
+	}
+	secret, err := oauthStateSecret()
+	if err != nil {
+		return "", err
+	}
+	claims := &oauthStateClaims{}
+	_, err = jwt.ParseWithClaims(stateToken, claims, func(t *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "state校验失败")
+	}
+	if claims.Provider != provider {
+		return "", errors.New("state和回调提供方不匹配")
+	}
+
+	nonceKey := fmt.Sprintf("%s%s", OAuthStateNoncePrefix, claims.Nonce)
+	nonceVal, err := u.ctx.GetRedisConn().GetDel(nonceKey)
+	if err != nil {
+		return "", errors.Wrap(err, "校验state nonce失败")
+	}
+	if nonceVal == "" {
+		return "", errors.New("state已失效或已被使用")
+	}
+
+	if claims.IPHash != hashFingerprint(util.GetClientPublicIP(r)) || claims.UAHash != hashFingerprint(r.UserAgent()) {
+		return "", errors.New("state和当前请求不匹配")
+	}
+	return claims.Authcode, nil
+}
+
+// hashFingerprint 对IP/UA这类指纹信息做单向哈希，state里不直接存明文
+func hashFingerprint(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:])
+}
+
+// oauthRedirectAllowed 校验回调地址是否在配置的白名单内，防止开放重定向。
+// 没有配置白名单时，只允许落在当前服务自己的 APIBaseURL 下的回调地址。
+func (u *User) oauthRedirectAllowed(redirectURL string) bool {
+	allowlist := strings.TrimSpace(os.Getenv("OAUTH_REDIRECT_ALLOWLIST"))
+	if allowlist == "" {
+		return strings.HasPrefix(redirectURL, u.ctx.GetConfig().External.APIBaseURL)
+	}
+	for _, prefix := range strings.Split(allowlist, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" && strings.HasPrefix(redirectURL, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/pkg/errors"
+)
+
+// DeviceTokenPrefix 是 uid 在某个推送通道上注册的设备token在 Redis 中的 key 前缀。
+// fcm/apns 这类通道推送目标是设备token，不是uid本身，必须先有调用方（比如客户端上报接口）
+// 替uid注册过token，才能真正推送成功。
+const DeviceTokenPrefix = "webhook:push:devicetoken:"
+
+// deviceTokenTTL 是注册的设备token的有效期，客户端预期会定期（比如每次启动）重新上报，
+// 长期不上报的设备视为已卸载/token已失效，到期自动失效比永久保留更安全。
+const deviceTokenTTL = 180 * 24 * time.Hour
+
+// deviceTokenStore 管理 uid -> 设备token 的映射，按通道区分（同一个uid在fcm和apns上是两个token）
+type deviceTokenStore struct {
+	ctx *config.Context
+}
+
+func newDeviceTokenStore(ctx *config.Context) *deviceTokenStore {
+	return &deviceTokenStore{ctx: ctx}
+}
+
+func deviceTokenKey(channel, uid string) string {
+	return DeviceTokenPrefix + channel + ":" + uid
+}
+
+// Register 记录 uid 在 channel 上的设备token，客户端每次拿到/刷新token后应该调用一次
+func (s *deviceTokenStore) Register(channel, uid, token string) error {
+	if err := s.ctx.GetRedisConn().SetAndExpire(deviceTokenKey(channel, uid), token, deviceTokenTTL); err != nil {
+		return errors.Wrap(err, "注册设备推送token失败")
+	}
+	return nil
+}
+
+// Get 查询 uid 在 channel 上注册的设备token，没有注册过返回空字符串
+func (s *deviceTokenStore) Get(channel, uid string) (string, error) {
+	token, err := s.ctx.GetRedisConn().GetString(deviceTokenKey(channel, uid))
+	if err != nil {
+		return "", errors.Wrap(err, "查询设备推送token失败")
+	}
+	return token, nil
+}
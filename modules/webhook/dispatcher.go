@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
+	"go.uber.org/zap"
+)
+
+// ChannelPrefPrefix 是用户订阅的推送通道列表在 Redis 中的 key 前缀（Redis Set）。
+// 没有订阅任何通道的用户，退回到只走 http 通道，这是老版本唯一支持的推送方式；
+// 不能退回到"所有已注册通道"，否则运营为告警开了 feishu/fcm 之类的通道后，
+// 每个没有显式订阅过的用户的私有推送内容都会被一并广播过去。
+const ChannelPrefPrefix = "webhook:push:channels:"
+
+// defaultChannels 是没有 Subscribe 记录时使用的通道列表
+var defaultChannels = []string{"http"}
+
+// PushDispatcher 把一条消息按 uid 订阅的通道 fan-out 推送出去，内置限流、带抖动的指数退避重试，
+// 以及重试耗尽后的死信落盘，替代老版本 EchoooPush.Push 里"只推第一个成功的server"的逻辑。
+type PushDispatcher struct {
+	log.Log
+	registry *NotifierRegistry
+	limiter  *uidRateLimiter
+	dlq      *deadLetterQueue
+	tokens   *deviceTokenStore
+	ctx      *config.Context
+	policy   retryPolicy
+}
+
+// NewPushDispatcher 根据配置注册内置的推送通道并返回一个可用的 PushDispatcher
+func NewPushDispatcher(ctx *config.Context) *PushDispatcher {
+	tokens := newDeviceTokenStore(ctx)
+	registry := NewNotifierRegistry()
+	for _, nc := range loadNotifierConfigs() {
+		if !nc.Enabled {
+			continue
+		}
+		registry.Register(newBuiltinNotifier(nc, tokens))
+	}
+	return &PushDispatcher{
+		Log:      log.NewTLog("PushDispatcher"),
+		registry: registry,
+		limiter:  newUIDRateLimiter(20, 2), // 默认每个uid允许20次突发，之后每秒恢复2次
+		dlq:      newDeadLetterQueue(ctx),
+		tokens:   tokens,
+		ctx:      ctx,
+		policy:   defaultRetryPolicy,
+	}
+}
+
+// RegisterDeviceToken 记录 uid 在某个推送通道（fcm/apns）上的设备token，客户端每次拿到/刷新
+// token后应该调用一次；fcm/apns 通道在推送前会查这张表把uid解析成真正的设备token，
+// 没有注册过的uid推送会直接报错而不是把uid错当成token发出去。
+func (d *PushDispatcher) RegisterDeviceToken(uid, channel, token string) error {
+	return d.tokens.Register(channel, uid, token)
+}
+
+// SetRateLimit 运行时调整每个uid的限流参数，供运营在某个通道被打满时临时调小
+func (d *PushDispatcher) SetRateLimit(capacity, refillPerSec float64) {
+	d.limiter.SetRate(capacity, refillPerSec)
+}
+
+// rateLimiterIdleTTL/rateLimiterCleanupInterval 控制令牌桶的回收：超过 idleTTL 没有推送过的uid，
+// 它的桶会在下一次清理时被删掉，避免在长期运行的IM服务上给每个收到过推送的uid永久占一条内存。
+const rateLimiterIdleTTL = 30 * time.Minute
+const rateLimiterCleanupInterval = 5 * time.Minute
+
+// StartRateLimiterCleanup 启动限流桶的周期性回收，应该在进程启动时调用一次，
+// ctx 被取消后清理循环退出，和 User.StartAvatarWorkerPool 的生命周期约定一致。
+func (d *PushDispatcher) StartRateLimiterCleanup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(rateLimiterCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.limiter.cleanup(rateLimiterIdleTTL)
+			}
+		}
+	}()
+}
+
+// Subscribe 记录 uid 订阅的推送通道，不调用的话只走 defaultChannels（http 通道）
+func (d *PushDispatcher) Subscribe(uid string, channels ...string) error {
+	key := ChannelPrefPrefix + uid
+	for _, channel := range channels {
+		if err := d.ctx.GetRedisConn().SAdd(key, channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispatch 把 content 推送给 uid 订阅的所有通道。限流按uid共用一个令牌桶，每个通道的推送各消耗一个令牌；
+// 每个通道独立重试、互不影响。
+func (d *PushDispatcher) Dispatch(ctx context.Context, uid string, content string) {
+	channels := d.channelsFor(uid)
+	for _, channel := range channels {
+		notifier, ok := d.registry.Get(channel)
+		if !ok {
+			continue
+		}
+		go d.dispatchOne(ctx, notifier, uid, content)
+	}
+}
+
+func (d *PushDispatcher) dispatchOne(ctx context.Context, notifier Notifier, uid, content string) {
+	if !d.limiter.Allow(uid) {
+		d.Info("推送被限流", zap.String("uid", uid), zap.String("channel", notifier.Name()))
+		return
+	}
+	attempts := 0
+	err := retryWithBackoff(d.policy, func(attempt int) error {
+		attempts = attempt
+		return notifier.Send(ctx, uid, content)
+	})
+	if err != nil {
+		d.Error("推送重试耗尽，写入死信队列", zap.String("uid", uid), zap.String("channel", notifier.Name()), zap.Error(err))
+		if dlqErr := d.dlq.Push(DeadLetter{
+			UID:      uid,
+			Channel:  notifier.Name(),
+			Content:  content,
+			Error:    err.Error(),
+			FailedAt: time.Now(),
+			Attempts: attempts,
+		}); dlqErr != nil {
+			d.Error("写入死信队列失败", zap.Error(dlqErr))
+		}
+	}
+}
+
+// channelsFor 返回 uid 订阅的通道列表，没有订阅记录时退回到 defaultChannels（只有http）
+func (d *PushDispatcher) channelsFor(uid string) []string {
+	channels, err := d.ctx.GetRedisConn().SMembers(ChannelPrefPrefix + uid)
+	if err != nil {
+		d.Error("读取用户订阅的推送通道失败", zap.String("uid", uid), zap.Error(err))
+	}
+	if len(channels) == 0 {
+		return defaultChannels
+	}
+	return channels
+}
+
+// ReplayDeadLetters 供运营重新投递死信队列中的消息，每条死信在弹出时就从队列里移除，
+// 不管重放是否成功都不会再留在队列里被下一次调用重复处理；返回重放成功的条数。
+func (d *PushDispatcher) ReplayDeadLetters(ctx context.Context, limit int64) (int, error) {
+	replayed := 0
+	for i := int64(0); i < limit; i++ {
+		letter, ok, err := d.dlq.Pop()
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+		notifier, ok := d.registry.Get(letter.Channel)
+		if !ok {
+			continue
+		}
+		if err := notifier.Send(ctx, letter.UID, letter.Content); err != nil {
+			d.Error("重放死信失败", zap.String("uid", letter.UID), zap.String("channel", letter.Channel), zap.Error(err))
+			continue
+		}
+		replayed++
+	}
+	return replayed, nil
+}
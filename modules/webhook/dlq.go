@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
+	"github.com/pkg/errors"
+)
+
+// DeadLetterKey 是推送死信队列在 Redis 中的 key，死信按推送发生的先后顺序存成一个list，
+// 方便运营按顺序查看和重放。
+const DeadLetterKey = "webhook:push:deadletter"
+
+// DeadLetterMaxLen 是死信队列保留的最大条数，超过后丢弃最旧的，避免无限增长打爆Redis
+const DeadLetterMaxLen = 10000
+
+// DeadLetter 记录一条耗尽重试次数的推送，供运营排查失败原因或重新投递
+type DeadLetter struct {
+	UID      string    `json:"uid"`
+	Channel  string    `json:"channel"`
+	Content  string    `json:"content"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	Attempts int       `json:"attempts"`
+}
+
+// deadLetterQueue 把推送失败的消息落到 Redis 的一个 list 里，支持运营侧查看和重放
+type deadLetterQueue struct {
+	ctx *config.Context
+}
+
+func newDeadLetterQueue(ctx *config.Context) *deadLetterQueue {
+	return &deadLetterQueue{ctx: ctx}
+}
+
+// Push 记录一条死信，并裁剪队列长度
+func (q *deadLetterQueue) Push(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	conn := q.ctx.GetRedisConn()
+	if err := conn.LPush(DeadLetterKey, string(data)); err != nil {
+		return errors.Wrap(err, "写入死信队列失败")
+	}
+	if err := conn.LTrim(DeadLetterKey, 0, DeadLetterMaxLen-1); err != nil {
+		return errors.Wrap(err, "裁剪死信队列失败")
+	}
+	return nil
+}
+
+// List 返回死信队列中最近的 limit 条记录，供运营排查，不会把记录从队列里移除
+func (q *deadLetterQueue) List(limit int64) ([]DeadLetter, error) {
+	raws, err := q.ctx.GetRedisConn().LRange(DeadLetterKey, 0, limit-1)
+	if err != nil {
+		return nil, errors.Wrap(err, "读取死信队列失败")
+	}
+	letters := make([]DeadLetter, 0, len(raws))
+	for _, raw := range raws {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(raw), &letter); err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+// Pop 弹出队列里最早的一条死信并从队列中移除，ok为false表示队列已经空了。
+// 重放要用 Pop 而不是 List，否则重复调用 ReplayDeadLetters 会把同一条消息重放多次。
+func (q *deadLetterQueue) Pop() (letter DeadLetter, ok bool, err error) {
+	raw, err := q.ctx.GetRedisConn().RPop(DeadLetterKey)
+	if err != nil {
+		return DeadLetter{}, false, errors.Wrap(err, "弹出死信队列失败")
+	}
+	if raw == "" {
+		return DeadLetter{}, false, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &letter); err != nil {
+		return DeadLetter{}, false, errors.Wrap(err, "解析死信记录失败")
+	}
+	return letter, true, nil
+}
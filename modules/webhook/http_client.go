@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sharedHTTPClient 是所有推送通道复用的 HTTP 客户端，开启连接池并设置超时，
+// 避免像之前的实现那样每次推送都用 http.Post/http.Get 默认客户端（没有超时、不复用连接）。
+var sharedHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// apiEnvelope 是推送服务响应的通用结构 {code, message, data}，各通道在判断调用是否
+// 真正成功时应该解析这个结构，而不是只看 HTTP 状态码——很多内部服务即使出错也返回200。
+type apiEnvelope struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// decodeEnvelope 解析响应体为 apiEnvelope，并在 code 非0（约定0为成功）时返回错误
+func decodeEnvelope(body []byte) (*apiEnvelope, error) {
+	var envelope apiEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, errors.Wrap(err, "解析推送响应失败")
+	}
+	if envelope.Code != 0 {
+		return &envelope, errors.Errorf("推送失败：%d %s", envelope.Code, envelope.Message)
+	}
+	return &envelope, nil
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"sync"
+)
+
+// Notifier 定义了一个推送通道需要实现的能力，新增一个通道（比如某个厂商的推送服务）
+// 只需要实现该接口并通过 NotifierRegistry.Register 注册，不需要改动 PushDispatcher。
+type Notifier interface {
+	// Name 返回通道标识，比如 http、feishu、fcm、apns、webhook，要和配置、用户订阅记录保持一致
+	Name() string
+	// Send 把 content 推送给 uid，失败时返回 error，由 PushDispatcher 负责重试
+	Send(ctx context.Context, uid string, content string) error
+}
+
+// NotifierRegistry 按名称管理已启用的 Notifier
+type NotifierRegistry struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+// NewNotifierRegistry 创建一个空的推送通道注册表
+func NewNotifierRegistry() *NotifierRegistry {
+	return &NotifierRegistry{
+		notifiers: map[string]Notifier{},
+	}
+}
+
+// Register 注册一个推送通道，重复注册同名通道会覆盖旧的
+func (r *NotifierRegistry) Register(n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[n.Name()] = n
+}
+
+// Get 按名称查找推送通道
+func (r *NotifierRegistry) Get(name string) (Notifier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n, ok := r.notifiers[name]
+	return n, ok
+}
+
+// Names 返回所有已注册的推送通道名称
+func (r *NotifierRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.notifiers))
+	for name := range r.notifiers {
+		names = append(names, name)
+	}
+	return names
+}
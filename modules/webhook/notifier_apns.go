@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	apnsProdHost    = "https://api.push.apple.com"
+	apnsSandboxHost = "https://api.sandbox.push.apple.com"
+)
+
+// apnsNotifier 通过 APNs 的 HTTP/2 接口推送iOS消息，用证书（CertPath 指向的 pem）做 mTLS 鉴权。
+// 推送目标是客户端注册的 APNs device token，不是uid本身，uid到token的映射查 tokens（deviceTokenStore）。
+type apnsNotifier struct {
+	host     string
+	topic    string
+	certPath string
+	tokens   *deviceTokenStore
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+func newAPNsNotifier(nc NotifierConfig, tokens *deviceTokenStore) *apnsNotifier {
+	host := apnsProdHost
+	if nc.Sandbox {
+		host = apnsSandboxHost
+	}
+	return &apnsNotifier{
+		host:     host,
+		topic:    nc.Topic,
+		certPath: nc.CertPath,
+		tokens:   tokens,
+	}
+}
+
+func (n *apnsNotifier) Name() string { return "apns" }
+
+// httpClient 懒加载带客户端证书的 HTTP/2 客户端，证书加载失败会在第一次 Send 时返回错误，
+// 而不是在构造 Notifier 时 panic，和其它内置提供方初始化失败时的处理方式保持一致。
+func (n *apnsNotifier) httpClient() (*http.Client, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.client != nil {
+		return n.client, nil
+	}
+	cert, err := tls.LoadX509KeyPair(n.certPath, n.certPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "加载apns推送证书失败")
+	}
+	n.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	return n.client, nil
+}
+
+type apnsPayload struct {
+	Aps struct {
+		Alert string `json:"alert"`
+	} `json:"aps"`
+}
+
+func (n *apnsNotifier) Send(ctx context.Context, uid string, content string) error {
+	token, err := n.tokens.Get(n.Name(), uid)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.Errorf("uid[%s]没有注册apns设备token，无法推送", uid)
+	}
+	client, err := n.httpClient()
+	if err != nil {
+		return err
+	}
+	var payload apnsPayload
+	payload.Aps.Alert = content
+	jsonData, err := json.Marshal(&payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/3/device/%s", n.host, token), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	if n.topic != "" {
+		req.Header.Set("apns-topic", n.topic)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return errors.Errorf("apns推送失败，状态码：%d %s", resp.StatusCode, string(body))
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"os"
+	"strings"
+)
+
+// NotifierConfig 描述一个推送通道的启用状态和必要参数，字段没有用到的通道可以留空。
+type NotifierConfig struct {
+	Name        string
+	Enabled     bool
+	ServerAddrs []string // http通道：内部推送服务地址列表，逗号分隔
+	WebhookURL  string   // feishu/webhook通道：目标地址
+	ServerKey   string   // fcm通道：FCM server key
+	CertPath    string   // apns通道：推送证书路径
+	Topic       string   // apns通道：bundle id
+	Sandbox     bool     // apns通道：是否使用沙盒环境
+}
+
+// loadNotifierConfigs 从环境变量读取各推送通道的配置，没有配置必要参数的通道视为未启用。
+// 这里没有走 config.Config 是因为推送通道是运维侧按需开关的旁路能力，环境变量足够灵活，
+// 不需要为每个通道都改一次配置结构体。
+func loadNotifierConfigs() []NotifierConfig {
+	var configs []NotifierConfig
+
+	if addrs := envWithDefault("ECHOOO_PUSH_SERVERS", ""); addrs != "" {
+		configs = append(configs, NotifierConfig{
+			Name:        "http",
+			Enabled:     true,
+			ServerAddrs: strings.Split(addrs, ","),
+		})
+	}
+	if url := envWithDefault("ECHOOO_FEISHU_WEBHOOK", ""); url != "" {
+		configs = append(configs, NotifierConfig{
+			Name:       "feishu",
+			Enabled:    true,
+			WebhookURL: url,
+		})
+	}
+	if key := envWithDefault("FCM_SERVER_KEY", ""); key != "" {
+		configs = append(configs, NotifierConfig{
+			Name:      "fcm",
+			Enabled:   true,
+			ServerKey: key,
+		})
+	}
+	if cert := envWithDefault("APNS_CERT_PATH", ""); cert != "" {
+		configs = append(configs, NotifierConfig{
+			Name:     "apns",
+			Enabled:  true,
+			CertPath: cert,
+			Topic:    envWithDefault("APNS_TOPIC", ""),
+			Sandbox:  envWithDefault("APNS_SANDBOX", "") == "1",
+		})
+	}
+	if url := envWithDefault("GENERIC_WEBHOOK_URL", ""); url != "" {
+		configs = append(configs, NotifierConfig{
+			Name:       "webhook",
+			Enabled:    true,
+			WebhookURL: url,
+		})
+	}
+	return configs
+}
+
+func envWithDefault(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
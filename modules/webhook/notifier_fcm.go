@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// fcmLegacyURL 是 FCM 老版 HTTP 接口地址
+const fcmLegacyURL = "https://fcm.googleapis.com/fcm/send"
+
+// fcmNotifier 通过 FCM 老版 HTTP 接口推送安卓消息，推送目标是客户端注册的FCM设备token，
+// 不是uid本身，uid到token的映射查 tokens（deviceTokenStore）
+type fcmNotifier struct {
+	serverKey string
+	tokens    *deviceTokenStore
+}
+
+func newFCMNotifier(nc NotifierConfig, tokens *deviceTokenStore) *fcmNotifier {
+	return &fcmNotifier{serverKey: nc.ServerKey, tokens: tokens}
+}
+
+func (n *fcmNotifier) Name() string { return "fcm" }
+
+type fcmSendReq struct {
+	To           string            `json:"to"`
+	Notification map[string]string `json:"notification"`
+}
+
+type fcmSendResp struct {
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+}
+
+func (n *fcmNotifier) Send(ctx context.Context, uid string, content string) error {
+	token, err := n.tokens.Get(n.Name(), uid)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return errors.Errorf("uid[%s]没有注册fcm设备token，无法推送", uid)
+	}
+	reqBody := fcmSendReq{
+		To:           token,
+		Notification: map[string]string{"body": content},
+	}
+	jsonData, err := json.Marshal(&reqBody)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fcmLegacyURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+n.serverKey)
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("fcm推送返回状态码：%d", resp.StatusCode)
+	}
+	var fr fcmSendResp
+	if err := json.Unmarshal(body, &fr); err != nil {
+		return errors.Wrap(err, "解析fcm推送响应失败")
+	}
+	if fr.Success == 0 {
+		return errors.New("fcm推送失败")
+	}
+	return nil
+}
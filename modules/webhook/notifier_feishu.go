@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// feishuNotifier 把推送内容转成飞书机器人文本消息发到配置的webhook地址，
+// 消息正文只有 content，uid 不会写进消息，所有uid的推送都发到同一个webhook地址。
+type feishuNotifier struct {
+	webhookURL string
+}
+
+func newFeishuNotifier(nc NotifierConfig) *feishuNotifier {
+	return &feishuNotifier{webhookURL: nc.WebhookURL}
+}
+
+func (n *feishuNotifier) Name() string { return "feishu" }
+
+type feishuTextMessage struct {
+	MsgType string `json:"msg_type"`
+	Content struct {
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+type feishuResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (n *feishuNotifier) Send(ctx context.Context, uid string, content string) error {
+	msg := feishuTextMessage{MsgType: "text"}
+	msg.Content.Text = content
+	jsonData, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("飞书推送返回状态码：%d", resp.StatusCode)
+	}
+	var fr feishuResp
+	if err := json.Unmarshal(body, &fr); err != nil {
+		return errors.Wrap(err, "解析飞书推送响应失败")
+	}
+	if fr.Code != 0 {
+		return errors.Errorf("飞书推送失败：%d %s", fr.Code, fr.Msg)
+	}
+	return nil
+}
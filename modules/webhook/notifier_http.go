@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// newBuiltinNotifier 根据 NotifierConfig.Name 构造对应的内置 Notifier 实现。
+// tokens 只有 fcm/apns 这类以设备token为推送目标的通道需要，用来把uid解析成真正的设备token。
+func newBuiltinNotifier(nc NotifierConfig, tokens *deviceTokenStore) Notifier {
+	switch nc.Name {
+	case "http":
+		return newHTTPNotifier(nc)
+	case "feishu":
+		return newFeishuNotifier(nc)
+	case "fcm":
+		return newFCMNotifier(nc, tokens)
+	case "apns":
+		return newAPNsNotifier(nc, tokens)
+	case "webhook":
+		return newGenericWebhookNotifier(nc)
+	}
+	return nil
+}
+
+// httpNotifier 推送给内部的IM推送服务（老版本 EchoooPush 内嵌的那套逻辑），
+// 和老版本的区别是：会依次尝试配置的每个server直到有一个真正推送成功（而不是遇到HTTP层面不报错就停），
+// 并且解析 {code,message,data} 结构判断是否真的成功。
+type httpNotifier struct {
+	serverAddrs []string
+}
+
+func newHTTPNotifier(nc NotifierConfig) *httpNotifier {
+	return &httpNotifier{serverAddrs: nc.ServerAddrs}
+}
+
+func (n *httpNotifier) Name() string { return "http" }
+
+func (n *httpNotifier) Send(ctx context.Context, uid string, content string) error {
+	var lastErr error
+	for _, server := range n.serverAddrs {
+		params := map[string]interface{}{"im_content": content}
+		reqBody := SendSinglePushReq{
+			UserId:     uid,
+			PushType:   3,
+			TemplateId: 27,
+			Params:     params,
+		}
+		jsonData, err := json.Marshal(&reqBody)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/inner/push/sendNotice", server), bytes.NewBuffer(jsonData))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := sharedHTTPClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = errors.Errorf("内部推送服务[%s]返回状态码：%d", server, resp.StatusCode)
+			continue
+		}
+		if _, err := decodeEnvelope(body); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("没有配置内部推送服务地址")
+	}
+	return lastErr
+}
+
+type SendSinglePushReq struct {
+	UserId     string                 `json:"userId"`
+	DeviceId   string                 `json:"deviceId"`
+	Lang       string                 `json:"lang"`
+	PushType   int                    `json:"pushType"`
+	TemplateId int                    `json:"templateId"`
+	Params     map[string]interface{} `json:"params"`
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// genericWebhookNotifier 是兜底的通用webhook通道，把 {uid, content} 原样POST给配置的地址，
+// 给没有现成SDK、或者运营临时接个内部服务的场景用，不强制要求响应体是 {code,message,data} 结构，
+// 只要求 2xx 状态码即为成功。
+type genericWebhookNotifier struct {
+	webhookURL string
+}
+
+func newGenericWebhookNotifier(nc NotifierConfig) *genericWebhookNotifier {
+	return &genericWebhookNotifier{webhookURL: nc.WebhookURL}
+}
+
+func (n *genericWebhookNotifier) Name() string { return "webhook" }
+
+func (n *genericWebhookNotifier) Send(ctx context.Context, uid string, content string) error {
+	jsonData, err := json.Marshal(map[string]string{"uid": uid, "content": content})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return errors.Errorf("webhook推送返回状态码：%d %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
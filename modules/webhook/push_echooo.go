@@ -1,88 +1,52 @@
 package webhook
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
+	"strings"
+
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/config"
 	"github.com/TangSengDaoDao/TangSengDaoDaoServerLib/pkg/log"
-	"go.uber.org/zap"
-	"net/http"
-	"strings"
-	"time"
 )
 
+// ECHOOO_PUSH_UID/ECHOOO_FEISHU_UID 是历史遗留下来的 Redis key 前缀，
+// 推送去重、限流这些能力现在统一由 PushDispatcher 的令牌桶负责，不再需要按uid单独维护。
 const (
 	ECHOOO_PUSH_UID   = "tsdd:echooo:push_uid:"
 	ECHOOO_FEISHU_UID = "tsdd:echooo:feishu_uid:"
 )
 
+// EchoooPush 是保留下来的旧版入口，内部已经换成 PushDispatcher（没有订阅记录的uid只走 http 通道），
+// 调用方不用改动就能获得重试、限流、死信队列这些新能力。
 type EchoooPush struct {
-	serverAddresses string
 	log.Log
-	ctx *config.Context
+	dispatcher *PushDispatcher
 }
 
+// NewEchoooPush 保持和旧版一致的构造签名，serverAddresses 会作为 http 通道的内部服务地址列表
 func NewEchoooPush(serverAddresses string, ctx *config.Context) *EchoooPush {
-
+	dispatcher := NewPushDispatcher(ctx)
+	if serverAddresses != "" {
+		dispatcher.registry.Register(newHTTPNotifier(NotifierConfig{ServerAddrs: splitServerAddresses(serverAddresses)}))
+	}
 	return &EchoooPush{
-		ctx:             ctx,
-		Log:             log.NewTLog("EchoooPush"),
-		serverAddresses: serverAddresses,
+		Log:        log.NewTLog("EchoooPush"),
+		dispatcher: dispatcher,
 	}
 }
 
-// Push 推送
+// Push 推送，委托给 PushDispatcher 异步fan-out到uid订阅的所有通道
 func (m *EchoooPush) Push(uid string, content string) error {
-	log.Info("EchoooPush serverAddresses", zap.String("serverAddresses", m.serverAddresses), zap.String("im_content", content))
-
-	key := fmt.Sprintf("%s%s", ECHOOO_PUSH_UID, uid)
-	result, err := m.ctx.GetRedisConn().GetString(key)
-	if err != nil {
-		m.Info("pushToEchoooApi to get cache key error")
-		return err
-	}
-
-	if len(result) > 0 {
-		m.Info("uid " + uid + " has push in five minutes. ")
-		return nil
-	}
-
-	if len(m.serverAddresses) > 0 {
-		servers := strings.Split(m.serverAddresses, ",")
-
-		for _, server := range servers {
-			m.Info("echooo inner Push server", zap.String("server", server), zap.String("uid", uid))
-			params := make(map[string]interface{})
-			params["im_content"] = content
-			reqParam := SendSinglePushReq{
-				UserId:     uid,
-				PushType:   3,
-				TemplateId: 27,
-				Params:     params,
-			}
-			jsonData, _ := json.Marshal(&reqParam)
-			resp, err := http.Post("http://"+server+"/inner/push/sendNotice", "application/json", bytes.NewBuffer(jsonData))
-			defer resp.Body.Close()
-			if err != nil {
-				m.Info("Error reading response body:", zap.Error(err))
-				continue
-			} else {
-				m.ctx.GetRedisConn().SetAndExpire(key, "1", time.Minute*5)
-				m.Info("echooo inner Push success server", zap.String("server", server), zap.String("uid", uid))
-				break
-			}
-
-		}
-	}
+	m.dispatcher.Dispatch(context.Background(), uid, content)
 	return nil
 }
 
-type SendSinglePushReq struct {
-	UserId     string                 `json:"userId"`
-	DeviceId   string                 `json:"deviceId"`
-	Lang       string                 `json:"lang"`
-	PushType   int                    `json:"pushType"`
-	TemplateId int                    `json:"templateId"`
-	Params     map[string]interface{} `json:"params"`
+func splitServerAddresses(serverAddresses string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(serverAddresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
 }
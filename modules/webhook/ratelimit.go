@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 是一个最朴素的令牌桶：容量为 capacity，每秒补充 refillPerSec 个令牌。
+type tokenBucket struct {
+	capacity     float64
+	refillPerSec float64
+	tokens       float64
+	updatedAt    time.Time
+}
+
+func newTokenBucket(capacity, refillPerSec float64) *tokenBucket {
+	return &tokenBucket{
+		capacity:     capacity,
+		refillPerSec: refillPerSec,
+		tokens:       capacity,
+		updatedAt:    time.Now(),
+	}
+}
+
+func (b *tokenBucket) allow() bool {
+	now := time.Now()
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	b.updatedAt = now
+	b.tokens += elapsed * b.refillPerSec
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// uidRateLimiter 为每个 uid 维护独立的令牌桶，防止单个用户的推送把下游通道打满。
+// capacity/refillPerSec 支持运行时调整（比如运营发现某个通道被打满需要临时调小），
+// 调整只影响之后新建的桶，已有的桶保持创建时的参数，不需要重启进程。
+type uidRateLimiter struct {
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+	capacity     float64
+	refillPerSec float64
+}
+
+// newUIDRateLimiter 创建一个限流器，capacity 是每个uid允许的突发次数，refillPerSec 是每秒恢复的次数
+func newUIDRateLimiter(capacity, refillPerSec float64) *uidRateLimiter {
+	return &uidRateLimiter{
+		buckets:      map[string]*tokenBucket{},
+		capacity:     capacity,
+		refillPerSec: refillPerSec,
+	}
+}
+
+// Allow 判断 uid 这次推送是否允许通过，超出速率限制返回false
+func (l *uidRateLimiter) Allow(uid string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[uid]
+	if !ok {
+		b = newTokenBucket(l.capacity, l.refillPerSec)
+		l.buckets[uid] = b
+	}
+	return b.allow()
+}
+
+// SetRate 运行时调整限流参数，只影响之后新建的桶
+func (l *uidRateLimiter) SetRate(capacity, refillPerSec float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.capacity = capacity
+	l.refillPerSec = refillPerSec
+}
+
+// cleanup 清掉超过 idleTTL 没有被访问过的桶，避免 buckets 按"曾经推送过的uid总数"无限增长。
+// 令牌桶超过 idleTTL 不用必然已经回满，删掉重建不会让哪个uid获得额外的突发配额。
+func (l *uidRateLimiter) cleanup(idleTTL time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for uid, b := range l.buckets {
+		if now.Sub(b.updatedAt) > idleTTL {
+			delete(l.buckets, uid)
+		}
+	}
+}
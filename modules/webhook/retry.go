@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"math/rand"
+	"time"
+)
+
+// retryPolicy 描述一次推送的重试参数：最多尝试 MaxAttempts 次，每次失败后按指数退避
+// 加随机抖动等待，避免大量失败请求同时重试造成下游雪崩。
+type retryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// retryWithBackoff 反复调用 fn 直到成功或者用尽重试次数，返回最后一次失败的 error。
+func retryWithBackoff(policy retryPolicy, fn func(attempt int) error) error {
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err := fn(attempt); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+		time.Sleep(backoffDelay(policy, attempt))
+	}
+	return lastErr
+}
+
+// backoffDelay 计算第 attempt 次失败后的等待时间：指数退避 + 0~1倍的随机抖动，上限 MaxDelay
+func backoffDelay(policy retryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay * time.Duration(1<<uint(attempt-1))
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) + 1))
+	total := delay + jitter
+	if total > policy.MaxDelay {
+		total = policy.MaxDelay
+	}
+	return total
+}